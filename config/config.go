@@ -20,9 +20,40 @@ func InitConfig() {
 	viper.SetDefault("service.workerpool.size", 3)
 	viper.SetDefault("heartbeat.timer", 45)
 
+	// discovery mode is either "tree" (single depth-bounded tree query) or "walk" (one call per folder)
+	viper.SetDefault("discovery.mode", "tree")
+	viper.SetDefault("discovery.tree.depth", 8)
+	// max. concurrent Jenkins calls per account while discovering, unless set in the account metadata
+	viper.SetDefault("discovery.concurrency", 4)
+	// number of assets sent per message on the master stream
+	viper.SetDefault("execution.batch.size", 100)
+	// reconcile the pipelines saved in the account metadata with the controller on every execution, which takes
+	// discovering every pipeline; otherwise only accounts requesting it with "refresh": true are, once
+	viper.SetDefault("execution.metadata.refresh", false)
+	// detect renamed and moved pipelines by their first build, walking folders takes an extra call per pipeline
+	viper.SetDefault("execution.track.renames", true)
+	// report the last build of pipelines, walking folders takes an extra call per pipeline unless renames are tracked
+	viper.SetDefault("execution.attributes.builds", true)
+	// discover the controllers managed by a CloudBees CI operations center the account points at
+	viper.SetDefault("execution.opscenter.fanout", true)
+	// send the credentials of the account to managed controllers on another host than the operations center
+	viper.SetDefault("execution.opscenter.otherhosts", false)
+	// seconds the detected product flavor of a controller is cached for, unless the controller is upgraded
+	viper.SetDefault("execution.flavor.ttl", 3600)
+	// account metadata encoding is either "json" or "compact" (gzip compressed prefix tree of the item paths),
+	// compact is opt-in as it leaves the metadata unreadable to anyone editing it by hand
+	viper.SetDefault("metadata.encoding", "json")
+	// warn when the account metadata, sent with every execution request, grows beyond this size in bytes
+	viper.SetDefault("metadata.size.budget", 1024*1024)
+
 	// 1GB max. recv size on grpc by default
 	viper.SetDefault("grpc.maxrecvsize", 1024*1024*1024)
 
+	// bytes of the Jenkins request and response bodies traced at debug level, 0 leaves bodies out
+	viper.SetDefault("http.trace.body.size", 1024)
+	// OAuth2 token endpoint of client credentials which do not name one
+	viper.SetDefault("auth.oauth2.token.url", "")
+
 	// dev stuff
 	viper.SetDefault("db.log.level", "debug")
 	viper.SetDefault("log.colour", false)
@@ -0,0 +1,87 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+)
+
+const AttrError = "error"
+const AttrErrorMessage = "errorMessage"
+
+const AssetErrorNotFound = "not-found"
+const AssetErrorForbidden = "forbidden"
+const AssetErrorInvalidURL = "invalid-url"
+const AssetErrorTimeout = "timeout"
+const AssetErrorOther = "error"
+
+// statusError is returned when Jenkins answers a request with an unexpected status
+type statusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d for %s", e.StatusCode, e.URL)
+}
+
+// assetErrorReason classifies why an asset could not be discovered
+func assetErrorReason(err error) string {
+	var urlErr *ItemURLError
+	if errors.As(err, &urlErr) {
+		return AssetErrorInvalidURL
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusNotFound:
+			return AssetErrorNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return AssetErrorForbidden
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return AssetErrorTimeout
+		}
+		return AssetErrorOther
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return AssetErrorTimeout
+	}
+	return AssetErrorOther
+}
+
+// toFailureResponse reports an asset that could not be discovered, so that the hub can tell it apart from
+// an asset that is gone from an account scan that failed
+func toFailureResponse(assetType string, subType string, identifier string, err error) *domain.MasterResponse {
+	return &domain.MasterResponse{
+		Asset: &domain.MasterAsset{
+			Type:       assetType,
+			SubType:    subType,
+			Identifier: identifier,
+			Attributes: map[string]string{
+				AttrError:        assetErrorReason(err),
+				AttrErrorMessage: err.Error(),
+			},
+		},
+	}
+}
+
+// nameIdentifier returns the identifier of the item with the given full name, or the name itself when the
+// account URL is unusable
+func nameIdentifier(jenkins *gojenkins.Jenkins, name string) string {
+	names := strings.Split(name, "/")
+	identifier, err := canonicalItemURL(jenkins.Server, &ItemPath{
+		Folders: names[:len(names)-1],
+		Name:    names[len(names)-1],
+	})
+	if err != nil {
+		return name
+	}
+	return identifier
+}
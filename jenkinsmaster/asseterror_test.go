@@ -0,0 +1,77 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_assetErrorReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "Not_Found",
+			err:  fmt.Errorf("unable to get nested jobs: %w", &statusError{URL: "https://jenkins/job/gone", StatusCode: http.StatusNotFound}),
+			want: AssetErrorNotFound,
+		},
+		{
+			name: "Forbidden",
+			err:  &statusError{URL: "https://jenkins/job/secret", StatusCode: http.StatusForbidden},
+			want: AssetErrorForbidden,
+		},
+		{
+			name: "Unauthorized",
+			err:  &statusError{URL: "https://jenkins/job/secret", StatusCode: http.StatusUnauthorized},
+			want: AssetErrorForbidden,
+		},
+		{
+			name: "Gateway_Timeout",
+			err:  &statusError{URL: "https://jenkins/job/slow", StatusCode: http.StatusGatewayTimeout},
+			want: AssetErrorTimeout,
+		},
+		{
+			name: "Server_Error",
+			err:  &statusError{URL: "https://jenkins/job/broken", StatusCode: http.StatusInternalServerError},
+			want: AssetErrorOther,
+		},
+		{
+			name: "Invalid_URL",
+			err:  &ItemURLError{URL: "job/app", Err: ErrItemURLNotAbsolute},
+			want: AssetErrorInvalidURL,
+		},
+		{
+			name: "Deadline",
+			err:  context.DeadlineExceeded,
+			want: AssetErrorTimeout,
+		},
+		{
+			name: "Network_Timeout",
+			err:  &url.Error{Op: "Get", URL: "https://jenkins/job/slow/api/json", Err: timeoutError{}},
+			want: AssetErrorTimeout,
+		},
+		{
+			name: "Other",
+			err:  errors.New("connection reset"),
+			want: AssetErrorOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assetErrorReason(tt.err); got != tt.want {
+				t.Errorf("assetErrorReason() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package jenkinsmaster
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const AttrDisplayName = "displayName"
+const AttrFullName = "fullName"
+const AttrParents = "parents"
+const AttrJobClass = "jobClass"
+const AttrBuildable = "buildable"
+const AttrDisabled = "disabled"
+const AttrDescription = "description"
+const AttrLastBuildAt = "lastBuildAt"
+
+// itemAttributes describes a pipeline so that the hub can group and filter pipelines on their own:
+//   - displayName and fullName, e.g. team-a/app/main
+//   - parents, the JSON array of the full names of the folders containing it, outermost first
+//   - jobClass, the Jenkins class of the job
+//   - buildable and disabled
+//   - description, when there is one
+//   - lastBuildAt, the RFC 3339 time of the last build, when there is one and it is known
+func itemAttributes(pipeline *pipelineJob) map[string]string {
+	path := jobPath(pipeline.Job)
+	fullName := strings.Join(path, "/")
+	attributes := map[string]string{
+		AttrDisplayName: pipeline.Raw.DisplayName,
+		AttrFullName:    fullName,
+		AttrJobClass:    pipeline.Raw.Class,
+		AttrBuildable:   strconv.FormatBool(pipeline.Raw.Buildable),
+		// a disabled job is greyed out whatever its last result
+		AttrDisabled: strconv.FormatBool(strings.HasPrefix(pipeline.Raw.Color, "disabled")),
+	}
+	if len(attributes[AttrDisplayName]) == 0 {
+		attributes[AttrDisplayName] = path[len(path)-1]
+	}
+	if len(path) > 1 {
+		parents := make([]string, len(path)-1)
+		for i := range parents {
+			parents[i] = strings.Join(path[:i+1], "/")
+		}
+		if data, err := json.Marshal(parents); err == nil {
+			attributes[AttrParents] = string(data)
+		}
+	}
+	if len(pipeline.Raw.Description) > 0 {
+		attributes[AttrDescription] = pipeline.Raw.Description
+	}
+	if pipeline.lastBuildAt > 0 {
+		attributes[AttrLastBuildAt] = time.UnixMilli(pipeline.lastBuildAt).UTC().Format(time.RFC3339)
+	}
+	return attributes
+}
@@ -0,0 +1,65 @@
+package jenkinsmaster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_itemAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline *pipelineJob
+		want     map[string]string
+	}{
+		{
+			name: "Nested_Built",
+			pipeline: &pipelineJob{
+				Job: &gojenkins.Job{Base: "/job/team-a/job/app/job/feature%2Flogin", Raw: &gojenkins.JobResponse{
+					Class:       "org.jenkinsci.plugins.workflow.job.WorkflowJob",
+					DisplayName: "feature/login",
+					Buildable:   true,
+					Color:       "blue_anime",
+					Description: "Login feature branch",
+				}},
+				lastBuildAt: 1704110400000,
+				buildsKnown: true,
+			},
+			want: map[string]string{
+				AttrDisplayName: "feature/login",
+				AttrFullName:    "team-a/app/feature/login",
+				AttrParents:     `["team-a","team-a/app"]`,
+				AttrJobClass:    "org.jenkinsci.plugins.workflow.job.WorkflowJob",
+				AttrBuildable:   "true",
+				AttrDisabled:    "false",
+				AttrDescription: "Login feature branch",
+				AttrLastBuildAt: "2024-01-01T12:00:00Z",
+			},
+		},
+		{
+			name: "Top_Level_Disabled_Never_Built",
+			pipeline: &pipelineJob{
+				Job: &gojenkins.Job{Base: "/job/standalone", Raw: &gojenkins.JobResponse{
+					Class: "org.jenkinsci.plugins.workflow.job.WorkflowJob",
+					Color: "disabled",
+				}},
+				buildsKnown: true,
+			},
+			want: map[string]string{
+				AttrDisplayName: "standalone",
+				AttrFullName:    "standalone",
+				AttrJobClass:    "org.jenkinsci.plugins.workflow.job.WorkflowJob",
+				AttrBuildable:   "false",
+				AttrDisabled:    "true",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemAttributes(tt.pipeline); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("itemAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package jenkinsmaster
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-compliance/chlog-go/log"
+	"github.com/spf13/viper"
+)
+
+const MetadataEncodingJSON = "json"
+const MetadataEncodingCompact = "compact"
+
+// compact metadata is gzip compressed, which plain JSON metadata never starts with
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compactAccountConfig is the compact metadata encoding: selected names and items are merged into
+// a prefix tree of their paths, and item URLs are only kept when they are not built on BaseURL.
+// It is opt-in with metadata.encoding, as the metadata is no longer readable JSON to anyone editing it.
+type compactAccountConfig struct {
+	Version     int      `json:"version"`
+	BaseURL     string   `json:"baseUrl,omitempty"`
+	Views       []string `json:"view,omitempty"`
+	Include     []string `json:"include,omitempty"`
+	Exclude     []string `json:"exclude,omitempty"`
+	Nodes       []string `json:"node"`
+	Concurrency int      `json:"concurrency,omitempty"`
+	// CredentialType, Diagnostics and Refresh are kept as is, see AccountConfig
+	CredentialType string           `json:"credentialType,omitempty"`
+	Diagnostics    *AuthDiagnostics `json:"diagnostics,omitempty"`
+	Refresh        bool             `json:"refresh,omitempty"`
+	Tree           []*compactNode   `json:"tree,omitempty"`
+}
+
+// compactNode is a path segment, it describes an item when Item is set
+type compactNode struct {
+	Name     string `json:"n"`
+	Selected bool   `json:"s,omitempty"`
+	Item     bool   `json:"i,omitempty"`
+	Class    string `json:"c,omitempty"`
+	URL      string `json:"u,omitempty"`
+	// NoURL tells an item without URL from one whose URL is built on BaseURL
+	NoURL    bool           `json:"x,omitempty"`
+	Found    int64          `json:"t,omitempty"`
+	Print    string         `json:"f,omitempty"`
+	Children []*compactNode `json:"j,omitempty"`
+}
+
+// encodeAccountConfig writes account metadata in the configured encoding and warns when it exceeds
+// the size budget, as it is sent along with every execution request
+func encodeAccountConfig(config *AccountConfig, requestId ...string) ([]byte, error) {
+	var metadata []byte
+	var err error
+	if viper.GetString("metadata.encoding") == MetadataEncodingCompact {
+		metadata, err = compactAccountConfigBytes(config)
+	} else {
+		metadata, err = json.Marshal(config)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if budget := viper.GetInt("metadata.size.budget"); budget > 0 && len(metadata) > budget {
+		log.Warn(requestId...).Msgf("Account Metadata of %v bytes for %v items exceeds the budget of %v bytes, "+
+			"consider the %s metadata encoding or narrowing the selection with views or patterns",
+			len(metadata), len(config.Items), budget, MetadataEncodingCompact)
+	}
+	return metadata, nil
+}
+
+func compactAccountConfigBytes(config *AccountConfig) ([]byte, error) {
+	compact := &compactAccountConfig{
+		Version:        MetadataVersion,
+		BaseURL:        itemsBaseURL(config.Items),
+		Views:          config.Views,
+		Include:        config.Include,
+		Exclude:        config.Exclude,
+		Nodes:          config.Nodes,
+		Concurrency:    config.Concurrency,
+		CredentialType: config.CredentialType,
+		Diagnostics:    config.Diagnostics,
+		Refresh:        config.Refresh,
+	}
+	nodes := map[string]*compactNode{}
+	for _, name := range config.Pipelines {
+		compact.node(nodes, name).Selected = true
+	}
+	for _, item := range config.Items {
+		node := compact.node(nodes, item.Path)
+		node.Item = true
+		node.Class = item.Class
+		if len(item.URL) == 0 {
+			node.NoURL = true
+		} else if item.URL != compactItemURL(compact.BaseURL, item.Path) {
+			node.URL = item.URL
+		}
+		if !item.DiscoveredAt.IsZero() {
+			node.Found = item.DiscoveredAt.Unix()
+		}
+		node.Print = item.Fingerprint
+	}
+
+	data, err := json.Marshal(compact)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// node returns the node of path, adding it and its parents to the tree as needed
+func (c *compactAccountConfig) node(nodes map[string]*compactNode, path string) *compactNode {
+	if node, ok := nodes[path]; ok {
+		return node
+	}
+	node := &compactNode{Name: path}
+	if idx := strings.LastIndex(path, "/"); idx >= 0 {
+		node.Name = path[idx+1:]
+		parent := c.node(nodes, path[:idx])
+		parent.Children = append(parent.Children, node)
+	} else {
+		c.Tree = append(c.Tree, node)
+	}
+	nodes[path] = node
+	return node
+}
+
+func isCompactAccountConfig(metadata []byte) bool {
+	return bytes.HasPrefix(metadata, gzipMagic)
+}
+
+func parseCompactAccountConfig(metadata []byte) (*AccountConfig, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(metadata))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	compact := new(compactAccountConfig)
+	if err := json.Unmarshal(data, compact); err != nil {
+		return nil, err
+	}
+	if compact.Version != MetadataVersion {
+		return nil, fmt.Errorf("unsupported compact account metadata version %d", compact.Version)
+	}
+
+	config := &AccountConfig{
+		Version:        compact.Version,
+		Views:          compact.Views,
+		Include:        compact.Include,
+		Exclude:        compact.Exclude,
+		Nodes:          compact.Nodes,
+		Concurrency:    compact.Concurrency,
+		CredentialType: compact.CredentialType,
+		Diagnostics:    compact.Diagnostics,
+		Refresh:        compact.Refresh,
+	}
+	var walk func(nodes []*compactNode, parent string)
+	walk = func(nodes []*compactNode, parent string) {
+		for _, node := range nodes {
+			path := parent + node.Name
+			if node.Selected {
+				config.Pipelines = append(config.Pipelines, path)
+			}
+			if node.Item {
+				item := &ItemMetadata{Path: path, Class: node.Class, URL: node.URL, Fingerprint: node.Print}
+				if len(item.URL) == 0 && !node.NoURL {
+					item.URL = compactItemURL(compact.BaseURL, path)
+				}
+				if node.Found != 0 {
+					item.DiscoveredAt = time.Unix(node.Found, 0).UTC()
+				}
+				config.Items = append(config.Items, item)
+			}
+			walk(node.Children, path+"/")
+		}
+	}
+	walk(compact.Tree, "")
+	return config, nil
+}
+
+// itemsBaseURL returns the account URL the item URLs are built on, taken from the first item having a URL
+func itemsBaseURL(items []*ItemMetadata) string {
+	for _, item := range items {
+		suffix := itemBase(strings.Split(item.Path, "/")...) + "/"
+		if strings.HasSuffix(item.URL, suffix) && len(item.URL) > len(suffix) {
+			return strings.TrimSuffix(item.URL, suffix)
+		}
+	}
+	return ""
+}
+
+// compactItemURL returns the URL of the item with the given path when built on baseURL, if known
+func compactItemURL(baseURL string, path string) string {
+	if len(baseURL) == 0 {
+		return ""
+	}
+	return baseURL + itemBase(strings.Split(path, "/")...) + "/"
+}
@@ -0,0 +1,134 @@
+package jenkinsmaster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_compactAccountConfig_roundTrip(t *testing.T) {
+	discovered := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		config *AccountConfig
+	}{
+		{
+			name: "Selection_And_Items",
+			config: &AccountConfig{
+				Version:     MetadataVersion,
+				Pipelines:   []string{"team-a", "team-a/app", "standalone"},
+				Exclude:     []string{"team-a/**/scratch"},
+				Nodes:       []string{"linux-*", "(built-in)"},
+				Concurrency: 2,
+				Items: []*ItemMetadata{
+					{Path: "team-a/app/main", URL: "https://jenkins/ci/job/team-a/job/app/job/main/", Class: JobClassPipeline, DiscoveredAt: discovered},
+					{Path: "team-a/my deploy", URL: "https://jenkins/ci/job/team-a/job/my%20deploy/", Class: JobClassPipeline, DiscoveredAt: discovered},
+					{Path: "standalone", URL: "https://jenkins/ci/job/standalone/", Class: JobClassPipeline, DiscoveredAt: discovered},
+				},
+			},
+		},
+		{
+			name: "Item_URL_On_Another_Base",
+			config: &AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"a"},
+				Items: []*ItemMetadata{
+					{Path: "a", URL: "https://jenkins/job/a/", Class: JobClassPipeline, DiscoveredAt: discovered},
+					{Path: "b", URL: "https://other/job/b/", Class: JobClassPipeline, DiscoveredAt: discovered},
+				},
+			},
+		},
+		{
+			// an item without URL stays without one rather than getting a URL built on the base
+			name: "Item_Without_URL",
+			config: &AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"a"},
+				Items: []*ItemMetadata{
+					{Path: "a", URL: "https://jenkins/job/a/", Class: JobClassPipeline, DiscoveredAt: discovered},
+					{Path: "b", Class: JobClassPipeline},
+				},
+			},
+		},
+		{
+			name: "Diagnostics",
+			config: &AccountConfig{
+				Version:        MetadataVersion,
+				Pipelines:      []string{"a"},
+				CredentialType: CredTypePassword,
+				Diagnostics:    &AuthDiagnostics{Failure: FailureUnauthorized, Diagnosis: "The controller rejected the credentials.", StatusCode: 401},
+			},
+		},
+		{
+			name: "No_Nodes",
+			config: &AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"a"},
+				Nodes:     []string{},
+			},
+		},
+		{
+			name: "Refresh_Requested",
+			config: &AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"a"},
+				Refresh:   true,
+			},
+		},
+		{
+			name: "Migrated_Items",
+			config: &AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"a"},
+				Items:     []*ItemMetadata{{Path: "a"}, {Path: "b/c"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := compactAccountConfigBytes(tt.config)
+			if err != nil {
+				t.Fatalf("compactAccountConfigBytes() error = %v", err)
+			}
+			got, err := parseAccountConfig(metadata)
+			if err != nil {
+				t.Fatalf("parseAccountConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.config) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.config)
+				t.Errorf("parseAccountConfig() got = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func Test_compactAccountConfig_size(t *testing.T) {
+	config := &AccountConfig{Version: MetadataVersion}
+	discovered := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for team := 0; team < 50; team++ {
+		for app := 0; app < 200; app++ {
+			path := fmt.Sprintf("organization/team-%d/application-%d", team, app)
+			config.Pipelines = append(config.Pipelines, path)
+			config.Items = append(config.Items, &ItemMetadata{
+				Path:         path,
+				URL:          compactItemURL("https://jenkins.example.com", path),
+				Class:        JobClassPipeline,
+				DiscoveredAt: discovered,
+			})
+		}
+	}
+	plain, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := compactAccountConfigBytes(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compact)*10 > len(plain) {
+		t.Errorf("compact metadata is %v bytes, want less than a tenth of the %v bytes of plain JSON", len(compact), len(plain))
+	}
+}
@@ -0,0 +1,119 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/bndr/gojenkins"
+)
+
+// ErrPartialDiscovery is returned along with the pipelines found so far when
+// discovery is cancelled or runs out of time before completing
+var ErrPartialDiscovery = errors.New("discovery did not complete, results are partial")
+
+// slots bounds the number of Jenkins calls a discovery makes at the same time
+type slots chan struct{}
+
+// withConcurrencyLimit allows at most limit concurrent Jenkins calls for discoveries using ctx
+func withConcurrencyLimit(ctx context.Context, limit int) context.Context {
+	if limit < 1 {
+		limit = 1
+	}
+	return context.WithValue(ctx, "discoverySlots", make(slots, limit))
+}
+
+// withSlot runs call once a slot is free, or fails when ctx is done first.
+// Slots are held for a single call only, so nested fan outs cannot deadlock.
+func withSlot(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s, ok := ctx.Value("discoverySlots").(slots)
+	if !ok {
+		return call()
+	}
+	select {
+	case s <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s }()
+	return call()
+}
+
+// collect calls discover for indexes 0 to n-1 concurrently and concatenates their pipelines in index order.
+// On the first error the remaining calls are cancelled; everything found until then is returned with that error.
+func collect(ctx context.Context, n int, discover func(ctx context.Context, i int) ([]*pipelineJob, error)) ([]*pipelineJob, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	results := make([][]*pipelineJob, n)
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			once.Do(func() { firstErr = err })
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pipelines, err := discover(ctx, i)
+			results[i] = pipelines
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var pipelines []*pipelineJob
+	for _, result := range results {
+		pipelines = append(pipelines, result...)
+	}
+	return pipelines, firstErr
+}
+
+// fetchJob polls the job at base, e.g. /job/folder/job/pipeline
+func fetchJob(ctx context.Context, jenkins *gojenkins.Jenkins, base string) (*gojenkins.Job, error) {
+	job := &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: base}
+	var status int
+	err := withSlot(ctx, func() (err error) {
+		status, err = job.Poll(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, &statusError{URL: jenkins.Server + base, StatusCode: status}
+	}
+	return job, nil
+}
+
+// getJSON fetches the JSON API of the item at base into v. gojenkins leaves the status of the answer to
+// the caller, any status but 200 fails here so that forbidden and missing items are told apart.
+func getJSON(ctx context.Context, jenkins *gojenkins.Jenkins, base string, v interface{}, query map[string]string) error {
+	var rsp *http.Response
+	err := withSlot(ctx, func() (err error) {
+		rsp, err = jenkins.Requester.GetJSON(ctx, base, v, query)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return &statusError{URL: jenkins.Server + base, StatusCode: rsp.StatusCode}
+	}
+	return nil
+}
+
+func fetchInnerJob(ctx context.Context, parent *gojenkins.Job, name string) (*gojenkins.Job, error) {
+	return fetchJob(ctx, parent.Jenkins, parent.Base+itemBase(name))
+}
@@ -0,0 +1,116 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_collect(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		n       int
+		failAt  int
+		want    int
+		wantErr error
+	}{
+		{
+			name:   "All_Succeed",
+			n:      10,
+			failAt: -1,
+			want:   10,
+		},
+		{
+			name:    "One_Fails",
+			n:       10,
+			failAt:  3,
+			wantErr: errFailed,
+		},
+		{
+			name:   "Empty",
+			n:      0,
+			failAt: -1,
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collect(context.Background(), tt.n, func(ctx context.Context, i int) ([]*pipelineJob, error) {
+				if i == tt.failAt {
+					return nil, errFailed
+				}
+				return []*pipelineJob{{Job: &gojenkins.Job{Base: "/job/" + strconv.Itoa(i)}}}, nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("collect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(got) != tt.want {
+				t.Fatalf("collect() got %v pipelines, want %v", len(got), tt.want)
+			}
+			for i, pipeline := range got {
+				if pipeline.Base != "/job/"+strconv.Itoa(i) {
+					t.Errorf("collect()[%v] = %v, results out of order", i, pipeline.Base)
+				}
+			}
+		})
+	}
+}
+
+func Test_withSlot_limit(t *testing.T) {
+	const limit = 2
+	ctx := withConcurrencyLimit(context.Background(), limit)
+	var running, maxRunning int32
+	// calls are held until limit of them run at once, so they are bound to overlap
+	full := make(chan struct{})
+	var once sync.Once
+	_, err := collect(ctx, 20, func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		return nil, withSlot(ctx, func() error {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				seen := atomic.LoadInt32(&maxRunning)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+					break
+				}
+			}
+			if current >= limit {
+				once.Do(func() { close(full) })
+			}
+			select {
+			case <-full:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("limit never reached")
+			}
+		})
+	})
+	if err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if maxRunning != limit {
+		t.Errorf("withSlot() ran %v calls at once, want exactly %v", maxRunning, limit)
+	}
+}
+
+func Test_withSlot_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(withConcurrencyLimit(context.Background(), 1))
+	cancel()
+	called := false
+	err := withSlot(ctx, func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("withSlot() error = %v, called = %v, want context.Canceled without calling", err, called)
+	}
+}
@@ -0,0 +1,124 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+)
+
+const AssetTypeController = "CONTROLLER"
+
+const AttrVersion = "version"
+const AttrFlavor = "flavor"
+const AttrInstanceIdentity = "instanceIdentity"
+const AttrRootURL = "rootUrl"
+
+// controllerInfo describes the Jenkins controller of an account
+type controllerInfo struct {
+	// rootURL is the root URL configured in Jenkins, empty when not configured
+	rootURL string
+	// version is the version reported in the X-Jenkins header
+	version string
+	// instanceIdentity is the public key of the controller reported in the X-Instance-Identity header
+	instanceIdentity string
+	// managesControllers is set when top level items of the controller are controllers, see managedControllerClasses
+	managesControllers bool
+	flavor             string
+}
+
+// controllerResponse holds the root URL Jenkins reports, older versions only report it through the primary view
+type controllerResponse struct {
+	URL         string `json:"url"`
+	PrimaryView struct {
+		URL string `json:"url"`
+	} `json:"primaryView"`
+	Jobs []struct {
+		Class string `json:"_class"`
+	} `json:"jobs"`
+}
+
+// fetchControllerInfo describes the controller from its root API and response headers, the flavor is only
+// guessed from the version, see detectFlavor
+func fetchControllerInfo(ctx context.Context, jenkins *gojenkins.Jenkins) (*controllerInfo, error) {
+	root := new(controllerResponse)
+	query := map[string]string{
+		"tree": "url,primaryView[url],jobs[_class]",
+	}
+	info := &controllerInfo{version: jenkins.Version}
+	err := withSlot(ctx, func() error {
+		rsp, err := jenkins.Requester.GetJSON(ctx, "/", root, query)
+		if rsp != nil {
+			if version := rsp.Header.Get("X-Jenkins"); len(version) > 0 {
+				info.version = version
+			}
+			info.instanceIdentity = rsp.Header.Get("X-Instance-Identity")
+		}
+		return err
+	})
+	info.flavor = flavorFromVersion(info.version)
+	if err != nil {
+		return info, err
+	}
+	info.rootURL = root.URL
+	if len(info.rootURL) == 0 {
+		info.rootURL = rootFromViewURL(root.PrimaryView.URL)
+	}
+	for _, job := range root.Jobs {
+		if managedControllerClasses[job.Class] {
+			info.managesControllers = true
+			break
+		}
+	}
+	return info, nil
+}
+
+// controllerIdentifier returns the identifier of the controller, the canonical account URL
+func controllerIdentifier(accountURL string) (string, error) {
+	base, err := canonicalBaseURL(accountURL)
+	if err != nil {
+		return "", err
+	}
+	return base + "/", nil
+}
+
+// isControllerIdentifier reports whether an asset identifier points at the controller rather than an item
+func isControllerIdentifier(accountURL string, identifier string) bool {
+	path, ok := relativePath(accountURL, identifier)
+	return ok && len(strings.Trim(path, "/")) == 0
+}
+
+func toControllerResponse(identifier string, info *controllerInfo) *domain.MasterResponse {
+	attributes := map[string]string{
+		AttrVersion: info.version,
+		AttrFlavor:  info.flavor,
+	}
+	if len(info.instanceIdentity) > 0 {
+		attributes[AttrInstanceIdentity] = info.instanceIdentity
+	}
+	if len(info.rootURL) > 0 {
+		attributes[AttrRootURL] = info.rootURL
+	}
+	return &domain.MasterResponse{
+		Asset: &domain.MasterAsset{
+			Type:       AssetTypeController,
+			SubType:    info.flavor,
+			Identifier: identifier,
+			Attributes: attributes,
+		},
+	}
+}
+
+// sendController hands the controller asset to the stream, it is reported along with the pipelines
+func (s *responseStream) sendController(accountURL string, info *controllerInfo) error {
+	identifier, err := controllerIdentifier(accountURL)
+	if err != nil {
+		log.Warn(s.requestId).Err(err).Msgf("Not reporting the controller of invalid account URL %s", accountURL)
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(toControllerResponse(identifier, info))
+}
@@ -0,0 +1,63 @@
+package jenkinsmaster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_isControllerIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		accountURL string
+		identifier string
+		want       bool
+	}{
+		{name: "Root", accountURL: "https://jenkins.example.com", identifier: "https://jenkins.example.com/", want: true},
+		{name: "Root_Without_Slash", accountURL: "https://jenkins.example.com/", identifier: "https://JENKINS.example.com:443", want: true},
+		{name: "Context_Path", accountURL: "https://example.com/ci", identifier: "https://example.com/ci/", want: true},
+		{name: "Item", accountURL: "https://jenkins.example.com", identifier: "https://jenkins.example.com/job/app/", want: false},
+		{name: "Other_Host", accountURL: "https://jenkins.example.com", identifier: "https://other.example.com/", want: false},
+		{name: "Above_Context_Path", accountURL: "https://example.com/ci", identifier: "https://example.com/", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isControllerIdentifier(tt.accountURL, tt.identifier); got != tt.want {
+				t.Errorf("isControllerIdentifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_responseStream_sendController(t *testing.T) {
+	stream := newResponseStream(nil, nil, "")
+	info := &controllerInfo{
+		rootURL:          "http://jenkins-internal:8080/",
+		version:          "2.401.1.3",
+		instanceIdentity: "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+		flavor:           FlavorCBCI,
+	}
+	if err := stream.sendController("https://Jenkins.example.com/", info); err != nil {
+		t.Fatalf("sendController() error = %v", err)
+	}
+	// requesting the controller through another identifier reports it once
+	if err := stream.sendController("https://jenkins.example.com:443", info); err != nil {
+		t.Fatalf("sendController() error = %v", err)
+	}
+	responses, _ := stream.finish()
+	if len(responses) != 1 {
+		t.Fatalf("sendController() sent %v responses, want 1", len(responses))
+	}
+	asset := responses[0].Asset
+	if asset.Type != AssetTypeController || asset.SubType != FlavorCBCI || asset.Identifier != "https://jenkins.example.com/" {
+		t.Errorf("sendController() asset = %v %v %v", asset.Type, asset.SubType, asset.Identifier)
+	}
+	want := map[string]string{
+		AttrVersion:          "2.401.1.3",
+		AttrFlavor:           FlavorCBCI,
+		AttrInstanceIdentity: "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+		AttrRootURL:          "http://jenkins-internal:8080/",
+	}
+	if !reflect.DeepEqual(asset.Attributes, want) {
+		t.Errorf("sendController() attributes = %v, want %v", asset.Attributes, want)
+	}
+}
@@ -0,0 +1,232 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bndr/gojenkins"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+	"github.com/spf13/viper"
+)
+
+// supportedCredTypes are the AccountCredential types the plugin can authenticate with
+var supportedCredTypes = map[string]bool{
+	CredTypePassword:  true,
+	CredTypeBearer:    true,
+	CredTypeOAuth2:    true,
+	CredTypeAnonymous: true,
+}
+
+var ErrIncompleteCredentials = errors.New("incomplete credentials")
+var ErrTokenEndpoint = errors.New("OAuth2 token endpoint failure")
+
+// tokenExpiryMargin is how long before it expires an OAuth2 access token is renewed
+const tokenExpiryMargin = 30 * time.Second
+
+// authorizer authorizes the requests sent to Jenkins
+type authorizer interface {
+	authorize(r *http.Request) error
+}
+
+// readCredentials reads the credentials of an account and checks that the fields its type needs are set
+func readCredentials(cred *domain.AccountCredential) (*jenkinsCreds, error) {
+	creds := &jenkinsCreds{}
+	if err := json.Unmarshal([]byte(cred.Credentials), creds); err != nil {
+		return nil, err
+	}
+	creds.Type = cred.Type
+	if len(creds.TokenURL) == 0 {
+		creds.TokenURL = viper.GetString("auth.oauth2.token.url")
+	}
+	transport, err := newTransport(creds)
+	if err != nil {
+		return nil, err
+	}
+	creds.transport = transport
+
+	var missing []string
+	require := func(field string, value string) {
+		if len(value) == 0 {
+			missing = append(missing, field)
+		}
+	}
+	require("url", creds.URL)
+	switch creds.Type {
+	case CredTypePassword:
+		require("userId", creds.UserID)
+		require("token", creds.Token)
+	case CredTypeBearer:
+		require("token", creds.Token)
+		creds.auth = bearerAuth(creds.Token)
+	case CredTypeOAuth2:
+		require("clientId", creds.ClientID)
+		require("clientSecret", creds.ClientSecret)
+		require("tokenUrl", creds.TokenURL)
+		creds.auth = &clientCredentialsAuth{
+			tokenURL:     creds.TokenURL,
+			clientID:     creds.ClientID,
+			clientSecret: creds.ClientSecret,
+			scopes:       creds.Scopes,
+			transport:    tokenTransport(creds.transport),
+		}
+	case CredTypeAnonymous:
+	default:
+		return nil, fmt.Errorf("unsupported credential type %q", creds.Type)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s credentials need %s", ErrIncompleteCredentials, creds.Type, strings.Join(missing, ", "))
+	}
+	return creds, nil
+}
+
+// newJenkins creates a client of the controller at url authenticating with creds
+func newJenkins(ctx context.Context, url string, creds *jenkinsCreds) *gojenkins.Jenkins {
+	client := newHttpClient(ctx, creds)
+	if creds.Type == CredTypePassword {
+		return gojenkins.CreateJenkins(&client, url, creds.UserID, creds.Token)
+	}
+	return gojenkins.CreateJenkins(&client, url)
+}
+
+// newHttpClient returns a client sending requests through the transport of creds, authorized with
+// their bearer or OAuth2 token. Password credentials are left to gojenkins.
+func newHttpClient(ctx context.Context, creds *jenkinsCreds) http.Client {
+	return http.Client{
+		Transport: &loggingTransport{ctx: ctx, auth: creds.auth, transport: creds.transport},
+	}
+}
+
+// newTransport returns the transport of the credentials, the default transport unless they configure TLS or a proxy
+func newTransport(creds *jenkinsCreds) (http.RoundTripper, error) {
+	config, err := tlsConfig(creds)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := proxyFunc(creds)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil && proxy == nil {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	return transport, nil
+}
+
+// close closes the idle connections of the transports created for the credentials, which are not shared
+// and would otherwise be kept open once the credentials are done with
+func (c *jenkinsCreds) close() {
+	closeIdleConnections(c.transport)
+	if auth, ok := c.auth.(*clientCredentialsAuth); ok {
+		closeIdleConnections(auth.transport)
+	}
+}
+
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// bearerAuth authorizes requests with a static bearer token
+type bearerAuth string
+
+func (a bearerAuth) authorize(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+string(a))
+	return nil
+}
+
+// clientCredentialsAuth authorizes requests with an access token obtained through the OAuth2 client
+// credentials grant, which is kept until shortly before it expires
+type clientCredentialsAuth struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	transport    http.RoundTripper
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (a *clientCredentialsAuth) authorize(r *http.Request) error {
+	token, err := a.accessToken(r.Context())
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// accessToken returns the current access token, requesting a new one when there is none or it is about to expire
+func (a *clientCredentialsAuth) accessToken(ctx context.Context) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.token) > 0 && (a.expires.IsZero() || time.Now().Before(a.expires)) {
+		return a.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.clientID), url.QueryEscape(a.clientSecret))
+
+	// the token endpoint is traced like Jenkins calls, without the Jenkins tree parameter
+	client := http.Client{Transport: &loggingTransport{ctx: ctx, raw: true, transport: a.transport}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: requesting an access token: %v", ErrTokenEndpoint, err)
+	}
+	defer resp.Body.Close()
+
+	var rsp tokenResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&rsp)
+	if resp.StatusCode != http.StatusOK {
+		if len(rsp.Error) > 0 {
+			return "", fmt.Errorf("%w: %s refused the client credentials: %s %s", ErrTokenEndpoint, a.tokenURL, rsp.Error, rsp.ErrorDescription)
+		}
+		return "", fmt.Errorf("%w: %v", ErrTokenEndpoint, &statusError{URL: a.tokenURL, StatusCode: resp.StatusCode})
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("%w: reading the access token: %v", ErrTokenEndpoint, decodeErr)
+	}
+	if len(rsp.AccessToken) == 0 {
+		return "", fmt.Errorf("%w: %s returned no access token", ErrTokenEndpoint, a.tokenURL)
+	}
+
+	a.token = rsp.AccessToken
+	a.expires = time.Time{}
+	if rsp.ExpiresIn > 0 {
+		a.expires = time.Now().Add(time.Duration(rsp.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+	return a.token, nil
+}
@@ -0,0 +1,157 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+)
+
+func Test_readCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		credType    string
+		credentials string
+		wantAuth    bool
+		wantErr     error
+	}{
+		{
+			name:        "Password",
+			credType:    CredTypePassword,
+			credentials: `{"url":"https://jenkins.example.com","userId":"admin","token":"11aa"}`,
+		},
+		{
+			name:        "Password_Without_Token",
+			credType:    CredTypePassword,
+			credentials: `{"url":"https://jenkins.example.com","userId":"admin"}`,
+			wantErr:     ErrIncompleteCredentials,
+		},
+		{
+			name:        "Bearer",
+			credType:    CredTypeBearer,
+			credentials: `{"url":"https://jenkins.example.com","token":"11aa"}`,
+			wantAuth:    true,
+		},
+		{
+			name:        "OAuth2",
+			credType:    CredTypeOAuth2,
+			credentials: `{"url":"https://jenkins.example.com","tokenUrl":"https://sso.example.com/token","clientId":"hub","clientSecret":"s3cr3t"}`,
+			wantAuth:    true,
+		},
+		{
+			name:        "OAuth2_Without_Token_URL",
+			credType:    CredTypeOAuth2,
+			credentials: `{"url":"https://jenkins.example.com","clientId":"hub","clientSecret":"s3cr3t"}`,
+			wantErr:     ErrIncompleteCredentials,
+		},
+		{
+			name:        "Anonymous",
+			credType:    CredTypeAnonymous,
+			credentials: `{"url":"https://jenkins.example.com"}`,
+		},
+		{
+			name:        "Anonymous_Without_URL",
+			credType:    CredTypeAnonymous,
+			credentials: `{}`,
+			wantErr:     ErrIncompleteCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := readCredentials(&domain.AccountCredential{Type: tt.credType, Credentials: tt.credentials})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if creds.Type != tt.credType {
+				t.Errorf("readCredentials() type = %v, want %v", creds.Type, tt.credType)
+			}
+			if (creds.auth != nil) != tt.wantAuth {
+				t.Errorf("readCredentials() auth = %v, want %v", creds.auth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func Test_parseAccount_CredentialType(t *testing.T) {
+	cs := &jenkinsMasterService{}
+	account := &domain.Account{
+		AccountCredential: []*domain.AccountCredential{
+			{Type: "ssh-key"},
+			{Type: CredTypeBearer},
+			{Type: CredTypePassword},
+		},
+	}
+	cred, err := cs.parseAccount(account)
+	if err != nil || cred.Type != CredTypeBearer {
+		t.Errorf("parseAccount() = %v, %v, want the %v credentials", cred, err, CredTypeBearer)
+	}
+	if _, err := cs.parseAccount(&domain.Account{AccountCredential: account.AccountCredential[:1]}); err == nil {
+		t.Errorf("parseAccount() error = nil, want no usable credentials")
+	}
+}
+
+func Test_clientCredentialsAuth(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		clientID, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read jobs" {
+			t.Errorf("token request form = %v", r.Form)
+		}
+		if clientID != "hub" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"at-%d","token_type":"Bearer","expires_in":3600}`, calls)
+	}))
+	defer server.Close()
+
+	auth := &clientCredentialsAuth{tokenURL: server.URL, clientID: "hub", clientSecret: "s3cr3t", scopes: []string{"read", "jobs"}}
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "https://jenkins.example.com/api/json", nil)
+		if err := auth.authorize(r); err != nil {
+			t.Fatalf("authorize() error = %v", err)
+		}
+		// the token is requested once and kept until it expires
+		if got := r.Header.Get("Authorization"); got != "Bearer at-1" {
+			t.Errorf("authorize() Authorization = %v, want Bearer at-1", got)
+		}
+	}
+
+	refused := &clientCredentialsAuth{tokenURL: server.URL, clientID: "hub", clientSecret: "wrong", scopes: auth.scopes}
+	if _, err := refused.accessToken(context.Background()); err == nil {
+		t.Errorf("accessToken() error = nil, want the client credentials refused")
+	}
+}
+
+// idleTransport counts the times its idle connections are closed
+type idleTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func Test_jenkinsCreds_close(t *testing.T) {
+	jenkinsTransport, tokenTransport := &idleTransport{}, &idleTransport{}
+	creds := &jenkinsCreds{
+		auth:      &clientCredentialsAuth{transport: tokenTransport},
+		transport: jenkinsTransport,
+	}
+	creds.close()
+	if jenkinsTransport.closed != 1 || tokenTransport.closed != 1 {
+		t.Errorf("close() closed the idle connections %v and %v times, want once", jenkinsTransport.closed, tokenTransport.closed)
+	}
+	// the default transport is shared and left alone
+	(&jenkinsCreds{}).close()
+}
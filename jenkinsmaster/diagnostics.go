@@ -0,0 +1,253 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/cloudbees-compliance/chlog-go/log"
+	service "github.com/cloudbees-compliance/chplugin-go/v0.4.0/servicev0_4_0"
+)
+
+// failures of the authentication check, the first ones are problems with the credentials themselves
+const FailureNoCredentials = "no-credentials"
+const FailureMalformedCredentials = "malformed-credentials"
+const FailureIncompleteCredentials = "incomplete-credentials"
+const FailureInvalidConnectionSettings = "invalid-connection-settings"
+const FailureDNS = "dns"
+const FailureConnectionRefused = "connection-refused"
+const FailureUnreachable = "unreachable"
+const FailureTimeout = "timeout"
+const FailureProxy = "proxy"
+const FailureTLSUnknownAuthority = "tls-unknown-authority"
+const FailureTLSInvalidCertificate = "tls-invalid-certificate"
+const FailureTLSHostnameMismatch = "tls-hostname-mismatch"
+const FailureTLSNotTLS = "tls-not-tls"
+const FailureTLSHandshakeRefused = "tls-handshake-refused"
+const FailureTokenEndpoint = "oauth2-token-endpoint"
+const FailureUnauthorized = "unauthorized"
+const FailureForbidden = "forbidden"
+const FailureNotFound = "not-found"
+const FailureNotJenkins = "not-jenkins"
+const FailureServerError = "server-error"
+const FailureDiscovery = "discovery"
+const FailureUnknown = "unknown"
+
+// credentialFailures are reported as CREDENTIALS_MISSING, the other failures as AUTHENTICATION_FAILURE
+var credentialFailures = map[string]bool{
+	FailureNoCredentials:             true,
+	FailureMalformedCredentials:      true,
+	FailureIncompleteCredentials:     true,
+	FailureInvalidConnectionSettings: true,
+}
+
+// AuthDiagnostics explains why the credentials of an account could not be validated. It is logged and
+// returned in the account metadata of the failed check, so that support can tell customers what to fix.
+type AuthDiagnostics struct {
+	Failure        string `json:"failure"`
+	Diagnosis      string `json:"diagnosis"`
+	Remediation    string `json:"remediation"`
+	CredentialType string `json:"credentialType,omitempty"`
+	URL            string `json:"url,omitempty"`
+	StatusCode     int    `json:"statusCode,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func newAuthDiagnostics(failure string, diagnosis string, remediation string, err error) *AuthDiagnostics {
+	diagnostics := &AuthDiagnostics{
+		Failure:     failure,
+		Diagnosis:   diagnosis,
+		Remediation: remediation,
+	}
+	if err != nil {
+		diagnostics.Error = err.Error()
+	}
+	return diagnostics
+}
+
+// diagnoseCredentials classifies a failure to find or read the credentials of an account
+func diagnoseCredentials(err error) *AuthDiagnostics {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, ErrNoUsableCredentials):
+		return newAuthDiagnostics(FailureNoCredentials, "The account has no credentials of a supported type.",
+			fmt.Sprintf("Add %s, %s, %s or %s credentials to the account.", CredTypePassword, CredTypeBearer, CredTypeOAuth2, CredTypeAnonymous), err)
+	case errors.As(err, &syntaxError), errors.As(err, &typeError):
+		return newAuthDiagnostics(FailureMalformedCredentials, "The credentials are not a valid JSON document.",
+			"Check the JSON of the credentials for syntax errors and fields of the wrong type, e.g. scopes and noProxy are arrays.", err)
+	case errors.Is(err, ErrIncompleteCredentials):
+		return newAuthDiagnostics(FailureIncompleteCredentials, "The credentials lack fields their type needs.",
+			"Fill in the fields named in the error.", err)
+	case errors.Is(err, ErrInvalidTLSConfig), errors.Is(err, ErrInvalidProxy):
+		return newAuthDiagnostics(FailureInvalidConnectionSettings, "The TLS or proxy settings of the credentials are invalid.",
+			"Check that caCertificates, clientCertificate and clientKey are PEM encoded and that proxyUrl is an http, https or socks5 URL.", err)
+	}
+	return newAuthDiagnostics(FailureMalformedCredentials, "The credentials could not be read.", "Check the credentials of the account.", err)
+}
+
+// diagnoseError classifies a failed Jenkins call. Failures reaching Jenkins without an error telling
+// why are left unknown, see diagnoseStatus.
+func diagnoseError(err error) *AuthDiagnostics {
+	var status *statusError
+	var opError *net.OpError
+	var dnsError *net.DNSError
+	var timeout interface{ Timeout() bool }
+	if failure, reason, ok := certificateError(err); ok {
+		return newAuthDiagnostics(failure, "The TLS handshake with the controller failed: "+reason+".",
+			"Set caCertificates to the CA bundle of the controller, serverName to the name its certificate is issued for "+
+				"or clientCertificate and clientKey when it requires mutual TLS.", err)
+	}
+	switch {
+	case errors.Is(err, ErrTokenEndpoint):
+		return newAuthDiagnostics(FailureTokenEndpoint, "No OAuth2 access token could be obtained from the token endpoint.",
+			"Check tokenUrl, clientId, clientSecret and scopes with the identity provider.", err)
+	case errors.As(err, &status) && status.StatusCode != http.StatusOK:
+		diagnostics := diagnoseStatus(status.StatusCode, nil)
+		diagnostics.Error = err.Error()
+		return diagnostics
+	case errors.As(err, &opError) && opError.Op == "proxyconnect", strings.Contains(err.Error(), http.StatusText(http.StatusProxyAuthRequired)):
+		return newAuthDiagnostics(FailureProxy, "The proxy could not be connected to or refused the connection to the controller.",
+			"Check proxyUrl, proxyUser and proxyPassword, or add the controller to noProxy.", err)
+	case errors.As(err, &dnsError):
+		return newAuthDiagnostics(FailureDNS, fmt.Sprintf("The host name %s could not be resolved.", dnsError.Name),
+			"Check the host name of the URL, or set proxyUrl when the controller is only known to an egress proxy.", err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeout) && timeout.Timeout():
+		return newAuthDiagnostics(FailureTimeout, "The controller did not answer in time.",
+			"Check that the controller is up and reachable from the plugin, through a proxy if it needs one.", err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return newAuthDiagnostics(FailureConnectionRefused, "The controller refused the connection.",
+			"Check the port and scheme of the URL and that the controller is running.", err)
+	case errors.As(err, &opError):
+		return newAuthDiagnostics(FailureUnreachable, "The controller could not be reached.",
+			"Check the URL and the network path from the plugin to the controller.", err)
+	}
+	return newAuthDiagnostics(FailureUnknown, "The controller could not be queried.", "Check the error and the controller logs.", err)
+}
+
+// diagnoseStatus classifies the answer of the controller to the authentication check
+func diagnoseStatus(statusCode int, header http.Header) *AuthDiagnostics {
+	var diagnostics *AuthDiagnostics
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		diagnostics = newAuthDiagnostics(FailureUnauthorized, "The controller rejected the credentials.",
+			"Check the user ID and API token, or that the bearer token has not expired or been revoked.", nil)
+	case statusCode == http.StatusForbidden:
+		diagnostics = newAuthDiagnostics(FailureForbidden, "The credentials are valid but lack the Overall/Read permission.",
+			"Grant the user Overall/Read and Job/Read, or let anonymous users read when using anonymous credentials.", nil)
+	case statusCode == http.StatusNotFound:
+		diagnostics = newAuthDiagnostics(FailureNotFound, "The URL does not point at the root of a controller.",
+			"Set the URL to the root of the controller, including its context path, e.g. https://example.com/jenkins.", nil)
+	case statusCode == http.StatusProxyAuthRequired:
+		diagnostics = newAuthDiagnostics(FailureProxy, "The proxy requires authentication.",
+			"Set proxyUser and proxyPassword.", nil)
+	case statusCode >= http.StatusInternalServerError:
+		diagnostics = newAuthDiagnostics(FailureServerError, "The controller, or a proxy in front of it, failed to answer.",
+			"Check that the controller is up and its logs.", nil)
+	case statusCode == http.StatusOK && header != nil && len(header.Get("X-Jenkins")) == 0:
+		diagnostics = newAuthDiagnostics(FailureNotJenkins, "The URL answers but not as a Jenkins controller.",
+			"Set the URL to the root of the controller rather than that of a login page or load balancer.", nil)
+	case statusCode == http.StatusOK:
+		return nil
+	default:
+		diagnostics = newAuthDiagnostics(FailureUnknown, fmt.Sprintf("The controller answered with status %d.", statusCode),
+			"Check the URL and the controller logs.", nil)
+	}
+	diagnostics.StatusCode = statusCode
+	return diagnostics
+}
+
+// probeController repeats the authentication check with a plain request to tell why it failed with err,
+// which gojenkins reduces to a message when the controller answers with an error status
+func probeController(ctx context.Context, creds *jenkinsCreds, err error) *AuthDiagnostics {
+	diagnostics := diagnoseError(err)
+	if diagnostics.Failure == FailureUnknown {
+		client := newHttpClient(ctx, creds)
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(creds.URL, "/")+"/api/json", nil)
+		if reqErr == nil {
+			if creds.Type == CredTypePassword {
+				req.SetBasicAuth(creds.UserID, creds.Token)
+			}
+			resp, probeErr := client.Do(req)
+			if probeErr != nil {
+				diagnostics = diagnoseError(probeErr)
+			} else {
+				resp.Body.Close()
+				if probed := diagnoseStatus(resp.StatusCode, resp.Header); probed != nil {
+					diagnostics = probed
+				}
+			}
+			diagnostics.Error = err.Error()
+		}
+	}
+	return diagnostics
+}
+
+// of records the credentials being checked, the URL with its user info redacted
+func (d *AuthDiagnostics) of(creds *jenkinsCreds) *AuthDiagnostics {
+	d.CredentialType = creds.Type
+	d.URL = creds.URL
+	if u, err := url.Parse(creds.URL); err == nil {
+		d.URL = redactURL(u)
+	}
+	return d
+}
+
+// result returns the result of the failed check. The diagnostics are added to the saved account metadata,
+// whose selection and settings are kept as is. Saved metadata that cannot be read is not written back.
+func (d *AuthDiagnostics) result(saved []byte) *service.AuthCheckResult {
+	result := service.AuthResult_AUTHENTICATION_FAILURE.Enum()
+	if credentialFailures[d.Failure] {
+		result = service.AuthResult_CREDENTIALS_MISSING.Enum()
+	}
+	d.log()
+	return &service.AuthCheckResult{
+		Result:          result,
+		AccountMetadata: d.accountMetadata(saved),
+	}
+}
+
+// accountMetadata returns the saved account metadata along with the diagnostics, nil when it cannot be read
+func (d *AuthDiagnostics) accountMetadata(saved []byte) []byte {
+	config := &AccountConfig{}
+	if len(saved) > 0 {
+		previous, err := parseAccountConfig(saved)
+		if err != nil {
+			log.Warn().Err(err).Msg("Unable to read the saved Account Metadata, not adding the diagnostics to it")
+			return nil
+		}
+		if previous != nil {
+			config = previous
+		}
+	}
+	config.Version = MetadataVersion
+	config.Diagnostics = d
+	if len(d.CredentialType) > 0 {
+		config.CredentialType = d.CredentialType
+	}
+	metadata, err := encodeAccountConfig(config)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to add the diagnostics to the Account Metadata")
+		return nil
+	}
+	return metadata
+}
+
+// log logs the diagnostics as a structured record
+func (d *AuthDiagnostics) log() {
+	log.Error().
+		Str("failure", d.Failure).
+		Str("diagnosis", d.Diagnosis).
+		Str("remediation", d.Remediation).
+		Str("credentialType", d.CredentialType).
+		Str("url", d.URL).
+		Int("statusCode", d.StatusCode).
+		Str("error", d.Error).
+		Msg("Jenkins authentication check failed")
+}
@@ -0,0 +1,214 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+	service "github.com/cloudbees-compliance/chplugin-go/v0.4.0/servicev0_4_0"
+)
+
+func Test_ValidateAuthentication_Diagnostics(t *testing.T) {
+	answer := func(status int, jenkins bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if jenkins {
+				w.Header().Set("X-Jenkins", "2.401.3")
+			}
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{}`)
+		}))
+	}
+	closed := answer(http.StatusOK, true)
+	closed.Close()
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Jenkins", "2.401.3")
+		fmt.Fprint(w, `{}`)
+	}))
+
+	tests := []struct {
+		name        string
+		credType    string
+		credentials func() string
+		wantResult  service.AuthResult
+		wantFailure string
+		wantStatus  int
+	}{
+		{
+			name:        "No_Credentials",
+			credType:    "ssh-key",
+			credentials: func() string { return `{}` },
+			wantResult:  service.AuthResult_CREDENTIALS_MISSING,
+			wantFailure: FailureNoCredentials,
+		},
+		{
+			name:        "Malformed_Credentials",
+			credType:    CredTypePassword,
+			credentials: func() string { return `{"url":"https://jenkins.example.com",` },
+			wantResult:  service.AuthResult_CREDENTIALS_MISSING,
+			wantFailure: FailureMalformedCredentials,
+		},
+		{
+			name:        "Incomplete_Credentials",
+			credType:    CredTypeBearer,
+			credentials: func() string { return `{"url":"https://jenkins.example.com"}` },
+			wantResult:  service.AuthResult_CREDENTIALS_MISSING,
+			wantFailure: FailureIncompleteCredentials,
+		},
+		{
+			name:        "Unauthorized",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(answer(http.StatusUnauthorized, true), t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureUnauthorized,
+			wantStatus:  http.StatusUnauthorized,
+		},
+		{
+			name:        "Forbidden",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(answer(http.StatusForbidden, true), t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureForbidden,
+			wantStatus:  http.StatusForbidden,
+		},
+		{
+			name:        "Wrong_Base_URL",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(answer(http.StatusNotFound, true), t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureNotFound,
+			wantStatus:  http.StatusNotFound,
+		},
+		{
+			name:        "Not_Jenkins",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(answer(http.StatusOK, false), t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureNotJenkins,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "Untrusted_Certificate",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(untrusted, t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureTLSUnknownAuthority,
+		},
+		{
+			name:        "Connection_Refused",
+			credType:    CredTypePassword,
+			credentials: func() string { return credentialsOf(closed, t) },
+			wantResult:  service.AuthResult_AUTHENTICATION_FAILURE,
+			wantFailure: FailureConnectionRefused,
+		},
+	}
+	// a failed check keeps the saved selection
+	saved, err := encodeAccountConfig(&AccountConfig{Version: MetadataVersion, Pipelines: []string{"team-a"}, Nodes: []string{"linux-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &jenkinsMasterService{}
+			req := &service.AuthCheckRequest{Account: &domain.Account{
+				AccountCredential: []*domain.AccountCredential{{Type: tt.credType, Credentials: tt.credentials()}},
+				Metadata:          saved,
+			}}
+			got, err := cs.ValidateAuthentication(context.Background(), req)
+			if err != nil {
+				t.Fatalf("ValidateAuthentication() error = %v", err)
+			}
+			if *got.Result != tt.wantResult {
+				t.Errorf("ValidateAuthentication() result = %v, want %v", *got.Result, tt.wantResult)
+			}
+			config, err := parseAccountConfig(got.AccountMetadata)
+			if err != nil || config == nil || config.Diagnostics == nil {
+				t.Fatalf("ValidateAuthentication() metadata = %s, %v, want diagnostics", got.AccountMetadata, err)
+			}
+			if !reflect.DeepEqual(config.Pipelines, []string{"team-a"}) || !reflect.DeepEqual(config.Nodes, []string{"linux-*"}) {
+				t.Errorf("ValidateAuthentication() metadata = %s, want the saved selection kept", got.AccountMetadata)
+			}
+			diagnostics := config.Diagnostics
+			if diagnostics.Failure != tt.wantFailure || diagnostics.StatusCode != tt.wantStatus {
+				t.Errorf("ValidateAuthentication() diagnostics = %+v, want %v %v", diagnostics, tt.wantFailure, tt.wantStatus)
+			}
+			if len(diagnostics.Diagnosis) == 0 || len(diagnostics.Remediation) == 0 {
+				t.Errorf("ValidateAuthentication() diagnostics = %+v, want a diagnosis and a remediation", diagnostics)
+			}
+		})
+	}
+}
+
+func Test_AuthDiagnostics_result(t *testing.T) {
+	diagnostics := newAuthDiagnostics(FailureUnauthorized, "The controller rejected the credentials.", "Check the API token.", nil)
+	if got := diagnostics.result([]byte(`{"pipeline":`)); got.AccountMetadata != nil {
+		t.Errorf("result() metadata = %s, want unreadable metadata left alone", got.AccountMetadata)
+	}
+	got := diagnostics.result(nil)
+	config, err := parseAccountConfig(got.AccountMetadata)
+	if err != nil || config == nil || config.Diagnostics == nil || config.Diagnostics.Failure != FailureUnauthorized {
+		t.Errorf("result() metadata = %s, %v, want the diagnostics", got.AccountMetadata, err)
+	}
+}
+
+// credentialsOf returns password credentials for the test server, which is closed along with the test
+func credentialsOf(server *httptest.Server, t *testing.T) string {
+	t.Cleanup(server.Close)
+	return fmt.Sprintf(`{"url":%q,"userId":"admin","token":"11aa"}`, server.URL)
+}
+
+func Test_diagnoseError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "DNS",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "jenkins.invalid", IsNotFound: true}},
+			want: FailureDNS,
+		},
+		{
+			name: "Proxy",
+			err:  &net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New("connection refused")},
+			want: FailureProxy,
+		},
+		{
+			name: "Timeout",
+			err:  fmt.Errorf("Get \"https://jenkins.example.com/api/json\": %w", context.DeadlineExceeded),
+			want: FailureTimeout,
+		},
+		{
+			name: "Token_Endpoint",
+			err:  fmt.Errorf("%w: https://sso.example.com/token refused the client credentials: invalid_client", ErrTokenEndpoint),
+			want: FailureTokenEndpoint,
+		},
+		{
+			name: "Status",
+			err:  &statusError{URL: "https://jenkins.example.com/job/team/api/json", StatusCode: http.StatusForbidden},
+			want: FailureForbidden,
+		},
+		{
+			name: "Server_Error",
+			err:  &statusError{URL: "https://jenkins.example.com/api/json", StatusCode: http.StatusBadGateway},
+			want: FailureServerError,
+		},
+		{
+			name: "Unknown",
+			err:  errors.New("Connection Failed, Please verify that the host and credentials are correct."),
+			want: FailureUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diagnoseError(tt.err); got.Failure != tt.want || len(got.Error) == 0 {
+				t.Errorf("diagnoseError() = %+v, want %v", got, tt.want)
+			}
+		})
+	}
+}
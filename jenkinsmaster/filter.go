@@ -0,0 +1,151 @@
+package jenkinsmaster
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RegexPatternPrefix marks an include or exclude pattern as a regular expression rather than a glob
+const RegexPatternPrefix = "regex:"
+
+// pipelineFilter selects pipelines by their full name, e.g. team-a/app/main.
+// Glob patterns match the whole name: * matches within a path segment, ** matches
+// across segments and ? matches a single character. Regular expressions match
+// anywhere in the name unless anchored.
+type pipelineFilter struct {
+	selected []string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	// roots are the items that need discovering to evaluate the include patterns
+	roots []string
+	// all is set when an include pattern can match a pipeline anywhere on the controller
+	all bool
+}
+
+func newPipelineFilter(config *AccountConfig) (*pipelineFilter, error) {
+	filter := &pipelineFilter{}
+	if config == nil {
+		return filter, nil
+	}
+
+	filter.selected = parsePipelineMap(config)
+	for _, pattern := range config.Include {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, re)
+		root := patternRoot(pattern)
+		if len(root) == 0 {
+			filter.all = true
+		} else {
+			filter.roots = append(filter.roots, root)
+		}
+	}
+	for _, pattern := range config.Exclude {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, re)
+	}
+
+	return filter, nil
+}
+
+// discoveryNames returns the items to discover, or nil when every pipeline has to be discovered
+func (f *pipelineFilter) discoveryNames() []string {
+	if f.all {
+		return nil
+	}
+	return append(append([]string{}, f.selected...), f.roots...)
+}
+
+// accepts reports whether the pipeline with the given full name is selected or included and not excluded
+func (f *pipelineFilter) accepts(name string) bool {
+	return f.isSelected(name) && !f.isExcluded(name)
+}
+
+func (f *pipelineFilter) isSelected(name string) bool {
+	for _, selected := range f.selected {
+		if name == selected || strings.HasPrefix(name, selected+"/") {
+			return true
+		}
+	}
+	return matchesAny(f.include, name)
+}
+
+func (f *pipelineFilter) isExcluded(name string) bool {
+	return matchesAny(f.exclude, name)
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	expr := globToRegexp(pattern)
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		expr = strings.TrimPrefix(pattern, RegexPatternPrefix)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+func globToRegexp(pattern string) string {
+	glob := []rune(pattern)
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// team-a/**/deploy also matches team-a/deploy
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+// patternRoot returns the folder a glob is confined to, e.g. team-a for team-a/**,
+// or an empty string when the pattern can match anywhere
+func patternRoot(pattern string) string {
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		return ""
+	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern
+	}
+	segments := strings.Split(pattern, "/")
+	var root []string
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, "*?") {
+			break
+		}
+		root = append(root, segment)
+	}
+	return strings.Join(root, "/")
+}
@@ -0,0 +1,142 @@
+package jenkinsmaster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_compilePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		matches []string
+		misses  []string
+		wantErr bool
+	}{
+		{
+			name:    "Glob_Double_Star",
+			pattern: "team-a/**",
+			matches: []string{"team-a/build", "team-a/app/main"},
+			misses:  []string{"team-a", "team-ab/build", "other/team-a/build"},
+		},
+		{
+			name:    "Glob_Single_Star",
+			pattern: "team-*/build",
+			matches: []string{"team-a/build", "team-/build"},
+			misses:  []string{"team-a/x/build", "team-a/build2"},
+		},
+		{
+			name:    "Glob_Double_Star_Middle",
+			pattern: "**/sandbox/**",
+			matches: []string{"sandbox/job", "team-a/sandbox/app/main"},
+			misses:  []string{"team-a/sandboxes/job"},
+		},
+		{
+			name:    "Glob_Question_Mark",
+			pattern: "app/PR-?",
+			matches: []string{"app/PR-1"},
+			misses:  []string{"app/PR-12", "app/PR-/"},
+		},
+		{
+			name:    "Glob_Literal_Meta_Characters",
+			pattern: "team.a/app (1)",
+			matches: []string{"team.a/app (1)"},
+			misses:  []string{"teamXa/app (1)"},
+		},
+		{
+			name:    "Glob_Unicode",
+			pattern: "équipe/*",
+			matches: []string{"équipe/déploiement"},
+			misses:  []string{"equipe/deploy"},
+		},
+		{
+			name:    "Regex",
+			pattern: "regex:^team-[ab]/.*-deploy$",
+			matches: []string{"team-a/prod-deploy", "team-b/x/qa-deploy"},
+			misses:  []string{"team-c/prod-deploy", "team-a/deploy-prod"},
+		},
+		{
+			name:    "Regex_Unanchored",
+			pattern: "regex:sandbox",
+			matches: []string{"team-a/sandbox-job"},
+			misses:  []string{"team-a/prod"},
+		},
+		{
+			name:    "Regex_Invalid",
+			pattern: "regex:team-(a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := compilePattern(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compilePattern() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, name := range tt.matches {
+				if !re.MatchString(name) {
+					t.Errorf("compilePattern(%q) does not match %q", tt.pattern, name)
+				}
+			}
+			for _, name := range tt.misses {
+				if re.MatchString(name) {
+					t.Errorf("compilePattern(%q) matches %q", tt.pattern, name)
+				}
+			}
+		})
+	}
+}
+
+func Test_patternRoot(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "team-a/**", want: "team-a"},
+		{pattern: "team-a/apps/*-deploy", want: "team-a/apps"},
+		{pattern: "team-a/app", want: "team-a/app"},
+		{pattern: "*/build", want: ""},
+		{pattern: "**", want: ""},
+		{pattern: "regex:^team-a/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := patternRoot(tt.pattern); got != tt.want {
+				t.Errorf("patternRoot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pipelineFilter_accepts(t *testing.T) {
+	filter, err := newPipelineFilter(&AccountConfig{
+		Pipelines: []string{"standalone", "team-b"},
+		Include:   []string{"team-a/**"},
+		Exclude:   []string{"**/sandbox/**", "regex:-tmp$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "standalone", want: true},
+		{name: "team-a/app", want: true},
+		{name: "team-a/sandbox/try", want: false},
+		{name: "team-b/build", want: true},
+		{name: "team-b/build-tmp", want: false},
+		{name: "team-c/build", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.accepts(tt.name); got != tt.want {
+				t.Errorf("accepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if names := filter.discoveryNames(); !reflect.DeepEqual(names, []string{"standalone", "team-b", "team-a"}) {
+		t.Errorf("discoveryNames() = %v", names)
+	}
+}
@@ -0,0 +1,177 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+	"github.com/spf13/viper"
+)
+
+// the product flavors of a controller, reported as the SubType of its assets
+const FlavorCBCI = "cbci"
+const FlavorCBCIOC = "cbci-oc"
+const FlavorJenkinsOSS = "jenkins-oss"
+
+// plugins only installed on an operations center
+var opsCenterPlugins = map[string]bool{
+	"operations-center-server": true,
+}
+
+// plugins bundled with every CloudBees CI controller
+var cloudBeesPlugins = map[string]bool{
+	"cloudbees-license":         true,
+	"operations-center-client":  true,
+	"cloudbees-folders-plus":    true,
+	"cloudbees-assurance":       true,
+	"cloudbees-analytics":       true,
+	"operations-center-context": true,
+}
+
+type pluginsResponse struct {
+	Plugins []struct {
+		ShortName string `json:"shortName"`
+		Active    bool   `json:"active"`
+	} `json:"plugins"`
+}
+
+// flavorFromVersion tells CloudBees CI from Jenkins by its version: CloudBees CI appends a fourth
+// number to the Jenkins version it is built on, e.g. 2.401.1.3
+func flavorFromVersion(version string) string {
+	segments := strings.Split(strings.TrimSpace(version), ".")
+	if len(segments) < 4 {
+		return FlavorJenkinsOSS
+	}
+	for _, segment := range segments {
+		if _, err := strconv.Atoi(segment); err != nil {
+			return FlavorJenkinsOSS
+		}
+	}
+	return FlavorCBCI
+}
+
+// fetchActivePlugins returns the short names of the active plugins. Listing plugins takes the
+// Overall/SystemRead permission, found is false when the account lacks it.
+func fetchActivePlugins(ctx context.Context, jenkins *gojenkins.Jenkins) (map[string]bool, bool, error) {
+	plugins := new(pluginsResponse)
+	query := map[string]string{
+		"tree": "plugins[shortName,active]",
+	}
+	var rsp *http.Response
+	err := withSlot(ctx, func() (err error) {
+		rsp, err = jenkins.Requester.GetJSON(ctx, "/pluginManager", plugins, query)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, false, nil
+	}
+	active := map[string]bool{}
+	for _, plugin := range plugins.Plugins {
+		if plugin.Active {
+			active[plugin.ShortName] = true
+		}
+	}
+	return active, true, nil
+}
+
+// detectFlavor tells an operations center and CloudBees CI controllers from Jenkins by their installed
+// plugins, falling back to the controllers an operations center holds and the version when the plugins
+// cannot be listed
+func detectFlavor(ctx context.Context, jenkins *gojenkins.Jenkins, info *controllerInfo, requestId string) string {
+	plugins, found, err := fetchActivePlugins(ctx, jenkins)
+	if err != nil {
+		log.Warn(requestId).Err(err).Msg("Unable to list the Jenkins plugins")
+	} else if !found {
+		log.Debug(requestId).Msg("Not allowed to list the Jenkins plugins")
+	}
+	return flavorOf(info, plugins)
+}
+
+func flavorOf(info *controllerInfo, plugins map[string]bool) string {
+	for plugin := range opsCenterPlugins {
+		if plugins[plugin] {
+			return FlavorCBCIOC
+		}
+	}
+	if info.managesControllers {
+		return FlavorCBCIOC
+	}
+	for plugin := range cloudBeesPlugins {
+		if plugins[plugin] {
+			return FlavorCBCI
+		}
+	}
+	return flavorFromVersion(info.version)
+}
+
+// flavorCache keeps the flavor of the controllers of each account, as it only changes on migrations
+type flavorCache struct {
+	mu      sync.Mutex
+	entries map[string]flavorEntry
+}
+
+type flavorEntry struct {
+	flavor string
+	// version is the version the flavor was detected on, an upgrade may change the flavor
+	version  string
+	detected time.Time
+}
+
+func newFlavorCache() *flavorCache {
+	return &flavorCache{entries: map[string]flavorEntry{}}
+}
+
+func flavorCacheKey(account string, controllerURL string) string {
+	return account + " " + strings.TrimRight(controllerURL, "/")
+}
+
+// get returns the cached flavor of a controller, unless it was detected on another version or has expired
+func (c *flavorCache) get(account string, controllerURL string, version string, now time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[flavorCacheKey(account, controllerURL)]
+	ttl := time.Duration(viper.GetInt("execution.flavor.ttl")) * time.Second
+	if !ok || entry.version != version || now.Sub(entry.detected) >= ttl {
+		return "", false
+	}
+	return entry.flavor, true
+}
+
+func (c *flavorCache) put(account string, controllerURL string, version string, flavor string, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[flavorCacheKey(account, controllerURL)] = flavorEntry{flavor: flavor, version: version, detected: now}
+}
+
+// describeController describes the controller of an account along with its flavor, which is only
+// detected again once the cached flavor expires or the controller is upgraded
+func (cs *jenkinsMasterService) describeController(ctx context.Context, account string, jenkins *gojenkins.Jenkins, requestId string) (*controllerInfo, error) {
+	info, err := fetchControllerInfo(ctx, jenkins)
+	if err != nil {
+		return info, err
+	}
+	if flavor, ok := cs.flavors.get(account, jenkins.Server, info.version, time.Now()); ok {
+		info.flavor = flavor
+		return info, nil
+	}
+	info.flavor = detectFlavor(ctx, jenkins, info, requestId)
+	log.Debug(requestId).Msgf("Detected flavor %s of Jenkins %s at %s", info.flavor, info.version, jenkins.Server)
+	if ctx.Err() == nil {
+		cs.flavors.put(account, jenkins.Server, info.version, info.flavor, time.Now())
+	}
+	return info, nil
+}
@@ -0,0 +1,111 @@
+package jenkinsmaster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func Test_flavorFromVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{name: "Jenkins_LTS", version: "2.401.3", want: FlavorJenkinsOSS},
+		{name: "Jenkins_Weekly", version: "2.420", want: FlavorJenkinsOSS},
+		{name: "CloudBees_CI", version: "2.401.1.3", want: FlavorCBCI},
+		{name: "Snapshot", version: "2.401.1-SNAPSHOT.3", want: FlavorJenkinsOSS},
+		{name: "Unknown", version: "", want: FlavorJenkinsOSS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flavorFromVersion(tt.version); got != tt.want {
+				t.Errorf("flavorFromVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_flavorOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *controllerInfo
+		plugins map[string]bool
+		want    string
+	}{
+		{
+			name:    "Operations_Center_Plugin",
+			info:    &controllerInfo{version: "2.401.1.3"},
+			plugins: map[string]bool{"operations-center-server": true, "cloudbees-license": true},
+			want:    FlavorCBCIOC,
+		},
+		{
+			name: "Managed_Controllers_Without_Plugins",
+			info: &controllerInfo{version: "2.401.1.3", managesControllers: true},
+			want: FlavorCBCIOC,
+		},
+		{
+			name:    "CloudBees_Plugin",
+			info:    &controllerInfo{version: "2.401.3"},
+			plugins: map[string]bool{"operations-center-client": true},
+			want:    FlavorCBCI,
+		},
+		{
+			name:    "Jenkins_Plugins",
+			info:    &controllerInfo{version: "2.401.3"},
+			plugins: map[string]bool{"workflow-job": true},
+			want:    FlavorJenkinsOSS,
+		},
+		{
+			name: "CloudBees_Version_Without_Plugins",
+			info: &controllerInfo{version: "2.401.1.3"},
+			want: FlavorCBCI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flavorOf(tt.info, tt.plugins); got != tt.want {
+				t.Errorf("flavorOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_flavorCache(t *testing.T) {
+	viper.Set("execution.flavor.ttl", 60)
+	defer viper.Set("execution.flavor.ttl", nil)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := newFlavorCache()
+	cache.put("account", "https://jenkins.example.com/", "2.401.1.3", FlavorCBCI, now)
+
+	tests := []struct {
+		name    string
+		account string
+		version string
+		at      time.Time
+		want    string
+		wantOk  bool
+	}{
+		{name: "Cached", account: "account", version: "2.401.1.3", at: now.Add(time.Minute - time.Second), want: FlavorCBCI, wantOk: true},
+		{name: "Expired", account: "account", version: "2.401.1.3", at: now.Add(time.Minute)},
+		{name: "Upgraded", account: "account", version: "2.414.1.1", at: now},
+		{name: "Other_Account", account: "other", version: "2.401.1.3", at: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cache.get(tt.account, "https://jenkins.example.com", tt.version, tt.at)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("get() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	var disabled *flavorCache
+	disabled.put("account", "https://jenkins.example.com", "2.401.1.3", FlavorCBCI, now)
+	if _, ok := disabled.get("account", "https://jenkins.example.com", "2.401.1.3", now); ok {
+		t.Errorf("get() on a nil cache found a flavor")
+	}
+}
@@ -0,0 +1,66 @@
+package jenkinsmaster
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+)
+
+// canonicalBaseURL normalizes the account URL identifiers are built on: lower case scheme and host,
+// no default port, no trailing slash, query or fragment, e.g. https://jenkins.example.com/ci
+func canonicalBaseURL(baseURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return "", err
+	}
+	if !isHTTPURL(base) {
+		return "", &url.Error{Op: "parse", URL: baseURL, Err: ErrItemURLNotAbsolute}
+	}
+	host := strings.ToLower(base.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := explicitPort(base); len(port) > 0 {
+		host += ":" + port
+	}
+	canonical := &url.URL{
+		Scheme: strings.ToLower(base.Scheme),
+		Host:   host,
+		Path:   strings.TrimRight(base.Path, "/"),
+	}
+	if len(base.RawPath) > 0 {
+		canonical.RawPath = strings.TrimRight(base.RawPath, "/")
+	}
+	return canonical.String(), nil
+}
+
+// canonicalItemURL returns the identifier of the item with the given path below the account URL.
+// It always ends with a slash and escapes item names the same way, so that every URL of an item,
+// whatever its host case, scheme, views or encoding, maps to a single identifier.
+func canonicalItemURL(baseURL string, path *ItemPath) (string, error) {
+	base, err := canonicalBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+	return base + path.Base() + "/", nil
+}
+
+// canonicalIdentifier normalizes an asset identifier given as a Jenkins item URL
+func canonicalIdentifier(baseURL string, identifier string) (string, error) {
+	path, err := ParseItemURL(baseURL, identifier)
+	if err != nil {
+		return "", err
+	}
+	return canonicalItemURL(baseURL, path)
+}
+
+// jobIdentifier returns the canonical identifier of a job. It is built from the account URL the job was
+// fetched with rather than the URL Jenkins reports, which depends on the configured Jenkins root URL.
+func jobIdentifier(j *gojenkins.Job) (string, error) {
+	names := jobPath(j)
+	return canonicalItemURL(j.Jenkins.Server, &ItemPath{
+		Folders: names[:len(names)-1],
+		Name:    names[len(names)-1],
+	})
+}
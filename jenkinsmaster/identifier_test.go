@@ -0,0 +1,123 @@
+package jenkinsmaster
+
+import (
+	"testing"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_canonicalIdentifier(t *testing.T) {
+	const want = "https://jenkins.example.com/ci/job/team%20a/job/app/job/feature%252Flogin/"
+	tests := []struct {
+		name       string
+		baseURL    string
+		identifier string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "Canonical",
+			baseURL:    "https://jenkins.example.com/ci",
+			identifier: want,
+			want:       want,
+		},
+		{
+			name:       "No_Trailing_Slash",
+			baseURL:    "https://jenkins.example.com/ci/",
+			identifier: "https://jenkins.example.com/ci/job/team%20a/job/app/job/feature%252Flogin",
+			want:       want,
+		},
+		{
+			name:       "Other_Scheme",
+			baseURL:    "https://jenkins.example.com/ci",
+			identifier: "http://jenkins.example.com/ci/job/team%20a/job/app/job/feature%252Flogin/",
+			want:       want,
+		},
+		{
+			name:       "Host_Case_And_Default_Port",
+			baseURL:    "HTTPS://Jenkins.Example.com:443/ci",
+			identifier: "https://JENKINS.example.com/ci/job/team%20a/job/app/job/feature%252Flogin/",
+			want:       want,
+		},
+		{
+			name:       "Different_Escaping_And_View",
+			baseURL:    "https://jenkins.example.com/ci",
+			identifier: "https://jenkins.example.com/ci/view/all/job/team+a/job/app/job/feature%252Flogin/?tab=1",
+			want:       "https://jenkins.example.com/ci/job/team+a/job/app/job/feature%252Flogin/",
+		},
+		{
+			name:       "Space_Escaping",
+			baseURL:    "https://jenkins.example.com/ci",
+			identifier: "https://jenkins.example.com/ci/job/team a/job/app/job/feature%252Flogin",
+			want:       want,
+		},
+		{
+			name:       "Other_Port",
+			baseURL:    "http://jenkins:8080",
+			identifier: "http://jenkins:8080/job/app",
+			want:       "http://jenkins:8080/job/app/",
+		},
+		{
+			name:       "Not_An_Item",
+			baseURL:    "https://jenkins.example.com/ci",
+			identifier: "https://jenkins.example.com/ci/",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalIdentifier(tt.baseURL, tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("canonicalIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalIdentifier() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jobIdentifier(t *testing.T) {
+	tests := []struct {
+		name   string
+		server string
+		base   string
+		url    string
+		want   string
+	}{
+		{
+			name:   "Top_Level",
+			server: "https://Jenkins.Example.com/",
+			base:   "/job/app",
+			url:    "https://jenkins.example.com/job/app/",
+			want:   "https://jenkins.example.com/job/app/",
+		},
+		{
+			name:   "Root_URL_Differs",
+			server: "https://jenkins.example.com/ci",
+			base:   "/job/team%20a/job/app",
+			url:    "http://jenkins-internal:8080/job/team%20a/job/app/",
+			want:   "https://jenkins.example.com/ci/job/team%20a/job/app/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &gojenkins.Job{
+				Jenkins: gojenkins.CreateJenkins(nil, tt.server),
+				Raw:     &gojenkins.JobResponse{URL: tt.url},
+				Base:    tt.base,
+			}
+			got, err := jobIdentifier(job)
+			if err != nil {
+				t.Fatalf("jobIdentifier() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("jobIdentifier() got = %v, want %v", got, tt.want)
+			}
+			canonical, err := canonicalIdentifier(tt.server, got)
+			if err != nil || canonical != got {
+				t.Errorf("canonicalIdentifier(%v) = %v, %v, want it unchanged", got, canonical, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package jenkinsmaster
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrItemURLEmpty        = errors.New("item URL is empty")
+	ErrItemURLMalformed    = errors.New("item URL is malformed")
+	ErrItemURLNotAbsolute  = errors.New("item URL is not an absolute http(s) URL")
+	ErrItemURLHostMismatch = errors.New("item URL host does not match the account URL")
+	ErrItemURLContextPath  = errors.New("item URL is not below the context path of the account URL")
+	ErrItemURLNotAnItem    = errors.New("item URL does not point to a job")
+)
+
+// ItemURLError reports why an item URL could not be parsed, Err is one of the ErrItemURL errors
+type ItemURLError struct {
+	URL string
+	Err error
+}
+
+func (e *ItemURLError) Error() string {
+	return fmt.Sprintf("invalid item URL %q: %v", e.URL, e.Err)
+}
+
+func (e *ItemURLError) Unwrap() error {
+	return e.Err
+}
+
+// ItemPath locates a Jenkins item by the decoded names of the folders containing it and its own name
+type ItemPath struct {
+	Folders []string
+	Name    string
+}
+
+// FullName returns the slash separated full name of the item, as Jenkins reports it
+func (p *ItemPath) FullName() string {
+	return strings.Join(append(append([]string{}, p.Folders...), p.Name), "/")
+}
+
+// Base returns the escaped URL path of the item relative to the Jenkins root
+func (p *ItemPath) Base() string {
+	return itemBase(append(append([]string{}, p.Folders...), p.Name)...)
+}
+
+// ParseItemURL parses the URL of a Jenkins item, e.g. https://host/ctx/job/folder/view/all/job/pipeline/,
+// into its item path. The URL must be on the host and below the context path of baseURL, though its scheme
+// and host case may differ. View segments are skipped and a trailing query or fragment is ignored.
+func ParseItemURL(baseURL string, itemURL string) (*ItemPath, error) {
+	fail := func(err error) (*ItemPath, error) {
+		return nil, &ItemURLError{URL: itemURL, Err: err}
+	}
+
+	if len(strings.TrimSpace(itemURL)) == 0 {
+		return fail(ErrItemURLEmpty)
+	}
+	base, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid account URL %q: %w", baseURL, err)
+	}
+	item, err := url.Parse(strings.TrimSpace(itemURL))
+	if err != nil {
+		return fail(ErrItemURLMalformed)
+	}
+	if !isHTTPURL(item) {
+		return fail(ErrItemURLNotAbsolute)
+	}
+	if !sameHost(base, item) {
+		return fail(ErrItemURLHostMismatch)
+	}
+
+	baseSegments, err := pathSegments(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account URL %q: %w", baseURL, err)
+	}
+	segments, err := pathSegments(item)
+	if err != nil {
+		return fail(ErrItemURLMalformed)
+	}
+	if len(segments) < len(baseSegments) {
+		return fail(ErrItemURLContextPath)
+	}
+	for i, segment := range baseSegments {
+		if segments[i] != segment {
+			return fail(ErrItemURLContextPath)
+		}
+	}
+
+	var names []string
+	segments = segments[len(baseSegments):]
+	for i := 0; i < len(segments); i += 2 {
+		if i+1 >= len(segments) || len(segments[i+1]) == 0 {
+			return fail(ErrItemURLNotAnItem)
+		}
+		switch segments[i] {
+		case "job":
+			names = append(names, segments[i+1])
+		case "view":
+			// views only group jobs, they are not part of the full name
+		default:
+			return fail(ErrItemURLNotAnItem)
+		}
+	}
+	if len(names) == 0 {
+		return fail(ErrItemURLNotAnItem)
+	}
+
+	return &ItemPath{
+		Folders: append([]string{}, names[:len(names)-1]...),
+		Name:    names[len(names)-1],
+	}, nil
+}
+
+func isHTTPURL(u *url.URL) bool {
+	scheme := strings.ToLower(u.Scheme)
+	return (scheme == "http" || scheme == "https") && len(u.Host) > 0
+}
+
+// sameHost compares hosts ignoring case, scheme and explicit default ports
+func sameHost(a *url.URL, b *url.URL) bool {
+	return strings.EqualFold(a.Hostname(), b.Hostname()) && explicitPort(a) == explicitPort(b)
+}
+
+func explicitPort(u *url.URL) string {
+	port := u.Port()
+	if port == "80" || port == "443" {
+		return ""
+	}
+	return port
+}
+
+// pathSegments returns the decoded segments of the URL path, a trailing slash is ignored
+func pathSegments(u *url.URL) ([]string, error) {
+	escaped := strings.Trim(u.EscapedPath(), "/")
+	if len(escaped) == 0 {
+		return nil, nil
+	}
+	var segments []string
+	for _, segment := range strings.Split(escaped, "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, decoded)
+	}
+	return segments, nil
+}
+
+// itemBase returns the escaped URL path of the item with the given path, e.g. /job/folder/job/my%20pipeline
+func itemBase(path ...string) string {
+	var base strings.Builder
+	for _, name := range path {
+		base.WriteString("/job/" + url.PathEscape(name))
+	}
+	return base.String()
+}
@@ -0,0 +1,242 @@
+package jenkinsmaster
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseItemURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		itemURL string
+		want    *ItemPath
+		wantErr error
+	}{
+		{
+			name:    "Top_Level",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/build/",
+			want:    &ItemPath{Folders: []string{}, Name: "build"},
+		},
+		{
+			name:    "Nested_With_Context_Path",
+			baseURL: "https://jenkins.example.com/ci/",
+			itemURL: "https://jenkins.example.com/ci/job/team-a/job/app/job/main",
+			want:    &ItemPath{Folders: []string{"team-a", "app"}, Name: "main"},
+		},
+		{
+			name:    "Encoded_Branch_Name",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/app/job/feature%252Flogin/",
+			want:    &ItemPath{Folders: []string{"app"}, Name: "feature%2Flogin"},
+		},
+		{
+			name:    "Encoded_Slash",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/app/job/feature%2Flogin/",
+			want:    &ItemPath{Folders: []string{"app"}, Name: "feature/login"},
+		},
+		{
+			name:    "Space",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/team%20a/job/my%20app/",
+			want:    &ItemPath{Folders: []string{"team a"}, Name: "my app"},
+		},
+		{
+			name:    "Unicode",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/%C3%A9quipe/job/d%C3%A9ploiement/",
+			want:    &ItemPath{Folders: []string{"équipe"}, Name: "déploiement"},
+		},
+		{
+			name:    "Unescaped_Unicode",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/équipe/",
+			want:    &ItemPath{Folders: []string{}, Name: "équipe"},
+		},
+		{
+			name:    "Job_Named_Job",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/job/job/job/",
+			want:    &ItemPath{Folders: []string{"job"}, Name: "job"},
+		},
+		{
+			name:    "Job_Named_View",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/view/",
+			want:    &ItemPath{Folders: []string{}, Name: "view"},
+		},
+		{
+			name:    "Views",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/view/teams/view/team-a/job/folder/view/all/job/app/",
+			want:    &ItemPath{Folders: []string{"folder"}, Name: "app"},
+		},
+		{
+			name:    "Query_And_Fragment",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/app/?tab=builds#top",
+			want:    &ItemPath{Folders: []string{}, Name: "app"},
+		},
+		{
+			name:    "Scheme_And_Host_Case_Differ",
+			baseURL: "https://Jenkins.Example.com/ci",
+			itemURL: "HTTP://jenkins.example.COM/ci/job/app",
+			want:    &ItemPath{Folders: []string{}, Name: "app"},
+		},
+		{
+			name:    "Default_Port",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com:443/job/app",
+			want:    &ItemPath{Folders: []string{}, Name: "app"},
+		},
+		{
+			name:    "Surrounding_Space",
+			baseURL: " https://jenkins.example.com ",
+			itemURL: " https://jenkins.example.com/job/app ",
+			want:    &ItemPath{Folders: []string{}, Name: "app"},
+		},
+		{
+			name:    "Empty",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "  ",
+			wantErr: ErrItemURLEmpty,
+		},
+		{
+			name:    "Relative",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "job/app/",
+			wantErr: ErrItemURLNotAbsolute,
+		},
+		{
+			name:    "Not_HTTP",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "ftp://jenkins.example.com/job/app/",
+			wantErr: ErrItemURLNotAbsolute,
+		},
+		{
+			name:    "Malformed",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/%zz/",
+			wantErr: ErrItemURLMalformed,
+		},
+		{
+			name:    "Other_Host",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://other.example.com/job/app/",
+			wantErr: ErrItemURLHostMismatch,
+		},
+		{
+			name:    "Other_Port",
+			baseURL: "https://jenkins.example.com:8443",
+			itemURL: "https://jenkins.example.com/job/app/",
+			wantErr: ErrItemURLHostMismatch,
+		},
+		{
+			name:    "Other_Context_Path",
+			baseURL: "https://jenkins.example.com/ci",
+			itemURL: "https://jenkins.example.com/cd/job/app/",
+			wantErr: ErrItemURLContextPath,
+		},
+		{
+			name:    "Context_Path_Prefix_Only",
+			baseURL: "https://jenkins.example.com/ci",
+			itemURL: "https://jenkins.example.com/ci2/job/app/",
+			wantErr: ErrItemURLContextPath,
+		},
+		{
+			name:    "Root",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/",
+			wantErr: ErrItemURLNotAnItem,
+		},
+		{
+			name:    "View_Only",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/view/teams/",
+			wantErr: ErrItemURLNotAnItem,
+		},
+		{
+			name:    "Build_URL",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/app/42/",
+			wantErr: ErrItemURLNotAnItem,
+		},
+		{
+			name:    "Dangling_Job_Segment",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job/app/job/",
+			wantErr: ErrItemURLNotAnItem,
+		},
+		{
+			name:    "Empty_Segment",
+			baseURL: "https://jenkins.example.com",
+			itemURL: "https://jenkins.example.com/job//job/app",
+			wantErr: ErrItemURLNotAnItem,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseItemURL(tt.baseURL, tt.itemURL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseItemURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				var urlErr *ItemURLError
+				if !errors.As(err, &urlErr) || urlErr.URL != tt.itemURL {
+					t.Errorf("ParseItemURL() error = %v, want an ItemURLError for %q", err, tt.itemURL)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseItemURL() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemPath_Base(t *testing.T) {
+	path := &ItemPath{Folders: []string{"team a", "app"}, Name: "feature%2Flogin"}
+	if got := path.Base(); got != "/job/team%20a/job/app/job/feature%252Flogin" {
+		t.Errorf("Base() = %v", got)
+	}
+	if got := path.FullName(); got != "team a/app/feature%2Flogin" {
+		t.Errorf("FullName() = %v", got)
+	}
+}
+
+func FuzzParseItemURL(f *testing.F) {
+	f.Add("https://jenkins.example.com/ci", "team-a/app/main")
+	f.Add("http://jenkins:8080", "feature%2Flogin")
+	f.Add("https://jenkins.example.com", "job/view/équipe")
+	f.Add("https://jenkins.example.com/", "my app/with?query#and fragment")
+	f.Fuzz(func(t *testing.T, baseURL string, fullName string) {
+		// arbitrary input must never panic
+		_, _ = ParseItemURL(baseURL, fullName)
+		_, _ = ParseItemURL(baseURL, baseURL+"/"+fullName)
+
+		names := strings.Split(fullName, "/")
+		for _, name := range names {
+			if len(name) == 0 {
+				return
+			}
+		}
+		if _, err := ParseItemURL(baseURL, baseURL); errors.Is(err, ErrItemURLNotAbsolute) || err == nil {
+			return
+		}
+		itemURL := strings.TrimSuffix(strings.TrimSpace(baseURL), "/") + itemBase(names...) + "/"
+		got, err := ParseItemURL(baseURL, itemURL)
+		if err != nil {
+			if errors.Is(err, ErrItemURLNotAnItem) {
+				t.Fatalf("ParseItemURL(%q, %q) error = %v", baseURL, itemURL, err)
+			}
+			return
+		}
+		if got.FullName() != fullName {
+			t.Fatalf("ParseItemURL(%q, %q) = %q, want %q", baseURL, itemURL, got.FullName(), fullName)
+		}
+	})
+}
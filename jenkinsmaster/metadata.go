@@ -0,0 +1,107 @@
+package jenkinsmaster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MetadataVersion is the version of the account metadata schema written by the plugin.
+// Unversioned metadata is the legacy version 0, which only holds the selected names.
+const MetadataVersion = 1
+
+// ItemMetadata describes a pipeline found on the controller
+type ItemMetadata struct {
+	// Path is the full name of the item, e.g. team-a/app
+	Path string `json:"path"`
+	// URL is the canonical identifier of the item
+	URL string `json:"url"`
+	// Class is the job class of the item, i.e. Pipeline
+	Class string `json:"class"`
+	// DiscoveredAt is when the item was first found on the controller
+	DiscoveredAt time.Time `json:"discoveredAt"`
+	// Fingerprint identifies the pipeline across renames and moves, it is empty when it was never built
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// accountConfigV0 is the legacy metadata layout, a list of selected names
+type accountConfigV0 struct {
+	Pipelines []string `json:"pipeline"`
+}
+
+// parseAccountConfig reads account metadata of any supported version and encoding. Legacy metadata
+// is migrated in memory, its Version stays 0 until it is written back.
+func parseAccountConfig(metadata []byte) (*AccountConfig, error) {
+	if isCompactAccountConfig(metadata) {
+		return parseCompactAccountConfig(metadata)
+	}
+
+	var version struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(metadata, &version); err != nil {
+		return nil, err
+	}
+
+	switch version.Version {
+	case 0:
+		var legacy *accountConfigV0
+		if err := json.Unmarshal(metadata, &legacy); err != nil {
+			return nil, err
+		}
+		if legacy == nil {
+			return nil, nil
+		}
+		return migrateAccountConfigV0(legacy), nil
+	case MetadataVersion:
+		var config *AccountConfig
+		if err := json.Unmarshal(metadata, &config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+	return nil, fmt.Errorf("unsupported account metadata version %d", version.Version)
+}
+
+// migrateAccountConfigV0 converts legacy metadata, the selected names are all it holds
+func migrateAccountConfigV0(legacy *accountConfigV0) *AccountConfig {
+	return &AccountConfig{Pipelines: legacy.Pipelines}
+}
+
+// metadataItem describes a discovered pipeline
+func metadataItem(pipeline *pipelineJob) *ItemMetadata {
+	name := jobFullName(pipeline.Job)
+	return &ItemMetadata{
+		Path:  name,
+		URL:   nameIdentifier(pipeline.Jenkins, name),
+		Class: JobClassPipeline,
+	}
+}
+
+// selectionName returns the name selecting a pipeline: the organization folder or multibranch project
+// creating it, so that repositories and branches created later are picked up, or the pipeline itself
+func selectionName(pipeline *pipelineJob) string {
+	if len(pipeline.organization) > 0 {
+		return pipeline.organization
+	}
+	if len(pipeline.multiBranch) > 0 {
+		return pipeline.multiBranch
+	}
+	return jobFullName(pipeline.Job)
+}
+
+// stampItems sets when items were first discovered: items already described in previous keep
+// their timestamp, the others are stamped with now
+func stampItems(items []*ItemMetadata, previous []*ItemMetadata, now time.Time) {
+	discoveredAt := map[string]time.Time{}
+	for _, item := range previous {
+		discoveredAt[item.Path] = item.DiscoveredAt
+	}
+	for _, item := range items {
+		if at, ok := discoveredAt[item.Path]; ok && !at.IsZero() {
+			item.DiscoveredAt = at
+		} else {
+			item.DiscoveredAt = now.UTC()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jenkinsmaster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseAccountConfig(t *testing.T) {
+	discovered := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		metadata string
+		want     *AccountConfig
+		wantErr  bool
+	}{
+		{
+			name:     "Legacy",
+			metadata: `{"pipeline": ["team-a/app", "standalone"]}`,
+			want:     &AccountConfig{Pipelines: []string{"team-a/app", "standalone"}},
+		},
+		{
+			// the legacy layout holds nothing else, versioned fields are not taken from it
+			name:     "Legacy_Other_Fields",
+			metadata: `{"pipeline": ["standalone"], "items": [{"path": "standalone"}]}`,
+			want:     &AccountConfig{Pipelines: []string{"standalone"}},
+		},
+		{
+			name:     "Legacy_Null",
+			metadata: `null`,
+		},
+		{
+			name: "Version_1",
+			metadata: `{"version": 1, "pipeline": ["team-a/app"], "concurrency": 2, "items": [
+				{"path": "team-a/app/main", "url": "https://jenkins/job/team-a/job/app/job/main/", "class": "Pipeline", "discoveredAt": "2024-01-01T12:00:00Z"}
+			]}`,
+			want: &AccountConfig{
+				Version:     1,
+				Pipelines:   []string{"team-a/app"},
+				Concurrency: 2,
+				Items: []*ItemMetadata{{
+					Path:         "team-a/app/main",
+					URL:          "https://jenkins/job/team-a/job/app/job/main/",
+					Class:        JobClassPipeline,
+					DiscoveredAt: discovered,
+				}},
+			},
+		},
+		{
+			name:     "Future_Version",
+			metadata: `{"version": 2, "pipeline": ["team-a/app"]}`,
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid",
+			metadata: `["team-a/app"]`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAccountConfig([]byte(tt.metadata))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAccountConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAccountConfig() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
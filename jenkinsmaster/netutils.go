@@ -1,38 +1,157 @@
 package jenkinsmaster
 
 import (
-	"github.com/cloudbees-compliance/chlog-go/log"
+	"bytes"
+	"context"
+	"io"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-compliance/chlog-go/log"
+	"github.com/spf13/viper"
 )
 
-type loggingTransport struct{}
+const redacted = "REDACTED"
+
+// headers carrying credentials or session state, besides those named after crumbs and tokens
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// sensitiveName matches the names of headers, query parameters and JSON fields holding secrets,
+// e.g. Jenkins-Crumb, token or apiToken
+var sensitiveName = regexp.MustCompile(`(?i)crumb|token|passw(or)?d|secret`)
+
+// sensitiveJSONField matches a JSON string field holding a secret, e.g. "crumb":"0a1b", including
+// a value cut short by truncation
+var sensitiveJSONField = regexp.MustCompile(`(?i)("[^"]*(?:crumb|token|passw(?:or)?d|secret)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|\\?$)`)
+
+// loggingTransport binds every request to ctx, as gojenkins does not pass its context on,
+// authorizes it with auth when set and traces every call with its credentials redacted
+type loggingTransport struct {
+	ctx  context.Context
+	auth authorizer
+	// raw leaves the query alone, for calls other than the Jenkins API
+	raw bool
+	// transport sends the requests, http.DefaultTransport when nil
+	transport http.RoundTripper
+}
 
 func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	bytes, _ := httputil.DumpRequestOut(r, true)
-	log.Debug().Msgf("Jenkins request is: %s", bytes)
+	r = r.WithContext(s.ctx)
 
-	values := r.URL.Query()
-	values.Add("tree", "jobs[name,url],*") //AdditionalA parameter added
-	r.URL.RawQuery = values.Encode()
+	if !s.raw {
+		values := r.URL.Query()
+		if !values.Has("tree") {
+			values.Add("tree", "jobs[name,url],*") //AdditionalA parameter added
+			r.URL.RawQuery = values.Encode()
+		}
+	}
+	if s.auth != nil {
+		// a round tripper must not modify the request it was given, WithContext copies its headers by reference
+		r.Header = r.Header.Clone()
+		if err := s.auth.authorize(r); err != nil {
+			return nil, err
+		}
+	}
 
-	log.Debug().Msgf("Jenkins request URL: %s", r.URL.String())
-	resp, err := http.DefaultTransport.RoundTrip(r)
+	transport := s.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := transport.RoundTrip(r)
+	traceCall(s.ctx, r, resp, err, time.Since(start))
+
+	return resp, err
+}
 
+// traceCall logs a Jenkins call at debug level: method, redacted URL and headers, status, latency and
+// the bodies truncated to http.trace.body.size bytes, along with the request ID of ctx
+func traceCall(ctx context.Context, r *http.Request, resp *http.Response, err error, latency time.Duration) {
+	requestId, _ := ctx.Value("requestId").(string)
+	event := log.Debug(requestId)
+	if !event.Enabled() {
+		return
+	}
+	event = event.Str("requestId", requestId).
+		Str("method", r.Method).
+		Str("url", redactURL(r.URL)).
+		Dur("latency", latency).
+		Interface("requestHeaders", redactHeaders(r.Header))
+
+	limit := viper.GetInt("http.trace.body.size")
+	if limit > 0 && r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, int64(limit)))
+			body.Close()
+			if len(data) > 0 {
+				event = event.Str("requestBody", redactBody(data)).Bool("requestBodyTruncated", len(data) == limit)
+			}
+		}
+	}
 	if err != nil {
-		if resp != nil {
-			respBytes, _ := httputil.DumpResponse(resp, true)
-			bytes = append(bytes, respBytes...)
-			log.Debug().Msgf("Jenkins response is: %s", bytes)
+		event.Err(err).Msg("Jenkins call failed")
+		return
+	}
+
+	event = event.Int("status", resp.StatusCode).
+		Interface("responseHeaders", redactHeaders(resp.Header))
+	if limit > 0 && resp.Body != nil {
+		data := peekBody(resp, limit)
+		if len(data) > 0 {
+			event = event.Str("responseBody", redactBody(data)).Bool("responseBodyTruncated", len(data) == limit)
 		}
 	}
+	event.Msg("Jenkins call")
+}
 
-	return resp, err
+// peekBody returns up to limit bytes of the response body, leaving the body to read in full
+func peekBody(resp *http.Response, limit int) []byte {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, int64(limit)))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+	return data
 }
 
-func GetHttpClient() http.Client {
-	client := http.Client{
-		Transport: &loggingTransport{},
+// redactURL returns the URL with its user info and secret query parameters redacted
+func redactURL(u *url.URL) string {
+	redactedURL := *u
+	if u.User != nil {
+		redactedURL.User = url.User(redacted)
 	}
-	return client
+	query := u.Query()
+	for name := range query {
+		if sensitiveName.MatchString(name) {
+			query[name] = []string{redacted}
+		}
+	}
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.String()
+}
+
+// redactHeaders returns the headers with credentials, cookies, crumbs and tokens redacted
+func redactHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		if sensitiveHeaders[strings.ToLower(name)] || sensitiveName.MatchString(name) {
+			headers[name] = redacted
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// redactBody returns a truncated body with the secret JSON fields redacted, e.g. crumbs and generated tokens
+func redactBody(data []byte) string {
+	return sensitiveJSONField.ReplaceAllString(string(data), `$1"`+redacted+`"`)
 }
@@ -0,0 +1,343 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+)
+
+const AssetTypeNode = "NODE"
+
+const NodeKindBuiltIn = "built-in"
+const NodeKindAgent = "agent"
+
+const LaunchMethodBuiltIn = "built-in"
+const LaunchMethodInbound = "inbound"
+const LaunchMethodOutbound = "outbound"
+
+const AttrNodeName = "name"
+const AttrLabels = "labels"
+const AttrOS = "os"
+const AttrExecutors = "executors"
+const AttrLaunchMethod = "launchMethod"
+const AttrOnline = "online"
+const AttrBuiltIn = "builtIn"
+
+// builtInNodeName names the built-in node in computer URLs, Jenkins before 2.307 named it (master)
+const builtInNodeName = "(built-in)"
+
+// computer classes of the built-in node, before and after Jenkins was renamed from Hudson
+var builtInComputerClasses = map[string]bool{
+	"hudson.model.Hudson$MasterComputer":   true,
+	"jenkins.model.Jenkins$MasterComputer": true,
+}
+
+const nodeFields = "_class,displayName,offline,numExecutors,jnlpAgent,assignedLabels[name]," +
+	"monitorData[hudson.node_monitors.ArchitectureMonitor]"
+
+// computerResponse is a node as reported by the computer API
+type computerResponse struct {
+	Class          string `json:"_class"`
+	DisplayName    string `json:"displayName"`
+	Offline        bool   `json:"offline"`
+	NumExecutors   int    `json:"numExecutors"`
+	JNLPAgent      bool   `json:"jnlpAgent"`
+	AssignedLabels []struct {
+		Name string `json:"name"`
+	} `json:"assignedLabels"`
+	MonitorData map[string]interface{} `json:"monitorData"`
+}
+
+type computerSetResponse struct {
+	Computer []*computerResponse `json:"computer"`
+}
+
+// nodeFilter selects nodes by name, entries are node names or patterns with the pipeline pattern syntax
+type nodeFilter struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+	// all is set when the account configuration does not select nodes, which selects every node
+	all bool
+}
+
+func newNodeFilter(config *AccountConfig) (*nodeFilter, error) {
+	filter := &nodeFilter{names: map[string]bool{}}
+	if config == nil || config.Nodes == nil {
+		filter.all = true
+		return filter, nil
+	}
+	for _, entry := range config.Nodes {
+		if !strings.ContainsAny(entry, "*?") && !strings.HasPrefix(entry, RegexPatternPrefix) {
+			filter.names[entry] = true
+			continue
+		}
+		re, err := compilePattern(entry)
+		if err != nil {
+			return nil, err
+		}
+		filter.patterns = append(filter.patterns, re)
+	}
+	return filter, nil
+}
+
+// any reports whether the filter selects nodes at all
+func (f *nodeFilter) any() bool {
+	return f.all || len(f.names) > 0 || len(f.patterns) > 0
+}
+
+func (f *nodeFilter) accepts(name string) bool {
+	return f.all || f.names[name] || matchesAny(f.patterns, name)
+}
+
+// isBuiltIn reports whether the computer is the built-in node, which used to be named master
+func (c *computerResponse) isBuiltIn() bool {
+	return builtInComputerClasses[c.Class]
+}
+
+// nodeName returns the name of the node in computer URLs and in the account configuration
+func (c *computerResponse) nodeName() string {
+	if c.isBuiltIn() {
+		return builtInNodeName
+	}
+	return c.DisplayName
+}
+
+func (c *computerResponse) launchMethod() string {
+	if c.isBuiltIn() {
+		return LaunchMethodBuiltIn
+	}
+	if c.JNLPAgent {
+		return LaunchMethodInbound
+	}
+	return LaunchMethodOutbound
+}
+
+// labels returns the labels assigned to the node, leaving out the label every node gets from its name
+func (c *computerResponse) labels() []string {
+	var labels []string
+	for _, label := range c.AssignedLabels {
+		if label.Name != c.DisplayName && label.Name != c.nodeName() && label.Name != "built-in" && label.Name != "master" {
+			labels = append(labels, label.Name)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// os returns the operating system and architecture reported by the node, e.g. Linux (amd64)
+func (c *computerResponse) os() string {
+	os, _ := c.MonitorData["hudson.node_monitors.ArchitectureMonitor"].(string)
+	return os
+}
+
+// fetchNodes returns every node of the controller, the built-in node included
+func fetchNodes(ctx context.Context, jenkins *gojenkins.Jenkins) ([]*computerResponse, error) {
+	computers := new(computerSetResponse)
+	query := map[string]string{
+		"tree": "computer[" + nodeFields + "]",
+	}
+	var rsp *http.Response
+	err := withSlot(ctx, func() (err error) {
+		rsp, err = jenkins.Requester.GetJSON(ctx, "/computer", computers, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, &statusError{URL: jenkins.Server + "/computer", StatusCode: rsp.StatusCode}
+	}
+	return computers.Computer, nil
+}
+
+// fetchNode returns the node with the given name
+func fetchNode(ctx context.Context, jenkins *gojenkins.Jenkins, name string) (*computerResponse, error) {
+	computer := new(computerResponse)
+	query := map[string]string{
+		"tree": nodeFields,
+	}
+	base := nodeBase(name)
+	var rsp *http.Response
+	err := withSlot(ctx, func() (err error) {
+		rsp, err = jenkins.Requester.GetJSON(ctx, base, computer, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, &statusError{URL: jenkins.Server + base, StatusCode: rsp.StatusCode}
+	}
+	return computer, nil
+}
+
+func nodeBase(name string) string {
+	return "/computer/" + url.PathEscape(name)
+}
+
+// nodeIdentifier returns the identifier of the node with the given name, its canonical computer URL
+func nodeIdentifier(accountURL string, name string) (string, error) {
+	base, err := canonicalBaseURL(accountURL)
+	if err != nil {
+		return "", err
+	}
+	return base + nodeBase(name) + "/", nil
+}
+
+// nodeNameFromIdentifier returns the name of the node an asset identifier points at, if any
+func nodeNameFromIdentifier(accountURL string, identifier string) (string, bool) {
+	path, ok := relativePath(accountURL, identifier)
+	if !ok {
+		return "", false
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != 2 || segments[0] != "computer" {
+		return "", false
+	}
+	name, err := url.PathUnescape(segments[1])
+	if err != nil || len(name) == 0 {
+		return "", false
+	}
+	// the built-in node is still reachable under its former name
+	if name == "(master)" {
+		name = builtInNodeName
+	}
+	return name, true
+}
+
+func toNodeResponse(identifier string, computer *computerResponse) *domain.MasterResponse {
+	subType := NodeKindAgent
+	if computer.isBuiltIn() {
+		subType = NodeKindBuiltIn
+	}
+	attributes := map[string]string{
+		AttrNodeName:     computer.nodeName(),
+		AttrLabels:       strings.Join(computer.labels(), " "),
+		AttrExecutors:    strconv.Itoa(computer.NumExecutors),
+		AttrLaunchMethod: computer.launchMethod(),
+		AttrOnline:       strconv.FormatBool(!computer.Offline),
+		AttrBuiltIn:      strconv.FormatBool(computer.isBuiltIn()),
+	}
+	if os := computer.os(); len(os) > 0 {
+		attributes[AttrOS] = os
+	}
+	return &domain.MasterResponse{
+		Asset: &domain.MasterAsset{
+			Type:       AssetTypeNode,
+			SubType:    subType,
+			Identifier: identifier,
+			Attributes: attributes,
+		},
+	}
+}
+
+// sendNodes hands the nodes to the stream, nodes already reported are skipped
+func (s *responseStream) sendNodes(accountURL string, computers []*computerResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, computer := range computers {
+		identifier, err := nodeIdentifier(accountURL, computer.nodeName())
+		if err != nil {
+			return err
+		}
+		if err := s.add(toNodeResponse(identifier, computer)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discoverNodes sends the nodes selected by the account configuration. Nodes named in the configuration
+// that do not exist are reported as not found, a failure to list the nodes fails them all.
+func discoverNodes(ctx context.Context, jenkins *gojenkins.Jenkins, filter *nodeFilter, responses *responseStream, requestId string) error {
+	computers, err := fetchNodes(ctx, jenkins)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Error(requestId).Err(err).Msg("Unable to get Jenkins nodes")
+		for name := range filter.names {
+			if err := responses.failNode(jenkins, name, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var selected []*computerResponse
+	found := map[string]bool{}
+	for _, computer := range computers {
+		// the built-in node can be selected by its current or former name
+		name := computer.nodeName()
+		found[name] = true
+		if filter.accepts(name) || filter.accepts(computer.DisplayName) || (computer.isBuiltIn() && filter.accepts("(master)")) {
+			selected = append(selected, computer)
+		}
+	}
+	log.Debug(requestId).Msgf("%v of %v Jenkins nodes selected", len(selected), len(computers))
+	if err := responses.sendNodes(jenkins.Server, selected); err != nil {
+		return err
+	}
+	for name := range filter.names {
+		if found[name] || (name == "(master)" && found[builtInNodeName]) {
+			continue
+		}
+		err := &statusError{URL: jenkins.Server + nodeBase(name), StatusCode: http.StatusNotFound}
+		if err := responses.failNode(jenkins, name, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendSelectedNodes sends the nodes requested by identifier, reporting those that cannot be fetched
+func sendSelectedNodes(ctx context.Context, jenkins *gojenkins.Jenkins, names []string, responses *responseStream, requestId string) error {
+	for _, name := range names {
+		computer, err := fetchNode(ctx, jenkins, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Error(requestId).Err(err).Msgf("Unable to get Jenkins node %s", name)
+			if err := responses.failNode(jenkins, name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := responses.sendNodes(jenkins.Server, []*computerResponse{computer}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failNode reports a selected node that could not be discovered, with the subtype it would have been reported with
+func (s *responseStream) failNode(jenkins *gojenkins.Jenkins, name string, err error) error {
+	return s.failAsset(AssetTypeNode, nodeKind(name), nodeFailureIdentifier(jenkins, name), err)
+}
+
+// nodeKind returns the kind of the node with the given name, current or former
+func nodeKind(name string) string {
+	if name == builtInNodeName || name == "(master)" {
+		return NodeKindBuiltIn
+	}
+	return NodeKindAgent
+}
+
+// nodeFailureIdentifier returns the identifier of a node that could not be discovered, or its name when
+// the account URL is unusable
+func nodeFailureIdentifier(jenkins *gojenkins.Jenkins, name string) string {
+	identifier, err := nodeIdentifier(jenkins.Server, name)
+	if err != nil {
+		return name
+	}
+	return identifier
+}
@@ -0,0 +1,169 @@
+package jenkinsmaster
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_nodeFilter_accepts(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		node  string
+		want  bool
+	}{
+		{name: "Name", nodes: []string{"linux-1"}, node: "linux-1", want: true},
+		{name: "Other_Name", nodes: []string{"linux-1"}, node: "linux-2", want: false},
+		{name: "Glob", nodes: []string{"linux-*"}, node: "linux-2", want: true},
+		{name: "Every_Node", nodes: []string{"*"}, node: "(built-in)", want: true},
+		{name: "Regex", nodes: []string{"regex:^win"}, node: "windows-1", want: true},
+		{name: "Nothing_Selected", nodes: []string{}, node: "linux-1", want: false},
+		{name: "No_Node_Key", node: "linux-1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newNodeFilter(&AccountConfig{Nodes: tt.nodes})
+			if err != nil {
+				t.Fatalf("newNodeFilter() error = %v", err)
+			}
+			if got := filter.accepts(tt.node); got != tt.want {
+				t.Errorf("accepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_responseStream_failNode(t *testing.T) {
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins.example.com")
+	tests := []struct {
+		name        string
+		node        string
+		wantSubType string
+	}{
+		{name: "Agent", node: "linux-1", wantSubType: NodeKindAgent},
+		{name: "Built_In", node: "(built-in)", wantSubType: NodeKindBuiltIn},
+		{name: "Former_Built_In", node: "(master)", wantSubType: NodeKindBuiltIn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := newResponseStream(nil, nil, "test").forController(nil, jenkins.Server, FlavorCBCI)
+			err := &statusError{URL: jenkins.Server + nodeBase(tt.node), StatusCode: http.StatusNotFound}
+			if err := responses.failNode(jenkins, tt.node, err); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := responses.finish()
+			if len(got) != 1 || got[0].Asset.Type != AssetTypeNode || got[0].Asset.SubType != tt.wantSubType {
+				t.Errorf("failNode() sent %v, want a %v node", got, tt.wantSubType)
+			}
+		})
+	}
+}
+
+func Test_nodeNameFromIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		want       string
+		wantOk     bool
+	}{
+		{name: "Agent", identifier: "https://jenkins.example.com/computer/linux-1/", want: "linux-1", wantOk: true},
+		{name: "Escaped", identifier: "https://jenkins.example.com/computer/my%20agent", want: "my agent", wantOk: true},
+		{name: "Built_In", identifier: "https://jenkins.example.com/computer/(built-in)/", want: "(built-in)", wantOk: true},
+		{name: "Former_Built_In", identifier: "https://jenkins.example.com/computer/(master)/", want: "(built-in)", wantOk: true},
+		{name: "Computer_Set", identifier: "https://jenkins.example.com/computer/", wantOk: false},
+		{name: "Job", identifier: "https://jenkins.example.com/job/computer/", wantOk: false},
+		{name: "Other_Host", identifier: "https://other.example.com/computer/linux-1/", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := nodeNameFromIdentifier("https://jenkins.example.com", tt.identifier)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("nodeNameFromIdentifier() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_toNodeResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		computer       string
+		wantSubType    string
+		wantIdentifier string
+		want           map[string]string
+	}{
+		{
+			name: "Inbound_Agent",
+			computer: `{"_class":"hudson.slaves.SlaveComputer","displayName":"linux 1","offline":false,"numExecutors":2,` +
+				`"jnlpAgent":true,"assignedLabels":[{"name":"linux"},{"name":"docker"},{"name":"linux 1"}],` +
+				`"monitorData":{"hudson.node_monitors.ArchitectureMonitor":"Linux (amd64)"}}`,
+			wantSubType:    NodeKindAgent,
+			wantIdentifier: "https://jenkins.example.com/computer/linux%201/",
+			want: map[string]string{
+				AttrNodeName:     "linux 1",
+				AttrLabels:       "docker linux",
+				AttrOS:           "Linux (amd64)",
+				AttrExecutors:    "2",
+				AttrLaunchMethod: LaunchMethodInbound,
+				AttrOnline:       "true",
+				AttrBuiltIn:      "false",
+			},
+		},
+		{
+			name: "Offline_Outbound_Agent",
+			computer: `{"_class":"hudson.slaves.SlaveComputer","displayName":"mac","offline":true,"numExecutors":1,` +
+				`"jnlpAgent":false,"assignedLabels":[{"name":"mac"}],"monitorData":{}}`,
+			wantSubType:    NodeKindAgent,
+			wantIdentifier: "https://jenkins.example.com/computer/mac/",
+			want: map[string]string{
+				AttrNodeName:     "mac",
+				AttrLabels:       "",
+				AttrExecutors:    "1",
+				AttrLaunchMethod: LaunchMethodOutbound,
+				AttrOnline:       "false",
+				AttrBuiltIn:      "false",
+			},
+		},
+		{
+			name: "Built_In_Node",
+			computer: `{"_class":"hudson.model.Hudson$MasterComputer","displayName":"Built-In Node","offline":false,` +
+				`"numExecutors":0,"assignedLabels":[{"name":"built-in"}],` +
+				`"monitorData":{"hudson.node_monitors.ArchitectureMonitor":"Linux (aarch64)"}}`,
+			wantSubType:    NodeKindBuiltIn,
+			wantIdentifier: "https://jenkins.example.com/computer/%28built-in%29/",
+			want: map[string]string{
+				AttrNodeName:     "(built-in)",
+				AttrLabels:       "",
+				AttrOS:           "Linux (aarch64)",
+				AttrExecutors:    "0",
+				AttrLaunchMethod: LaunchMethodBuiltIn,
+				AttrOnline:       "true",
+				AttrBuiltIn:      "true",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			computer := new(computerResponse)
+			if err := json.Unmarshal([]byte(tt.computer), computer); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			identifier, err := nodeIdentifier("https://Jenkins.example.com/", computer.nodeName())
+			if err != nil {
+				t.Fatalf("nodeIdentifier() error = %v", err)
+			}
+			got := toNodeResponse(identifier, computer).Asset
+			if got.Type != AssetTypeNode || got.SubType != tt.wantSubType || got.Identifier != tt.wantIdentifier {
+				t.Errorf("toNodeResponse() = %v %v %v, want %v %v %v", got.Type, got.SubType, got.Identifier,
+					AssetTypeNode, tt.wantSubType, tt.wantIdentifier)
+			}
+			if !reflect.DeepEqual(got.Attributes, tt.want) {
+				t.Errorf("toNodeResponse() attributes = %v, want %v", got.Attributes, tt.want)
+			}
+		})
+	}
+}
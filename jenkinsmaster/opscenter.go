@@ -0,0 +1,193 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+	service "github.com/cloudbees-compliance/chplugin-go/v0.4.0/servicev0_4_0"
+	"github.com/spf13/viper"
+)
+
+// AttrController tags every asset with the identifier of the controller it lives on
+const AttrController = "controller"
+
+// item classes of the controllers an operations center manages, provisioned by it or connected to it
+var managedControllerClasses = map[string]bool{
+	"com.cloudbees.opscenter.server.model.ManagedMaster": true,
+	"com.cloudbees.opscenter.server.model.ClientMaster":  true,
+}
+
+const opsCenterItemFields = "_class,name,endpoint"
+
+// ErrControllerOtherHost is returned for a managed controller on another host than the account URL, which the
+// credentials of the account are not sent to unless execution.opscenter.otherhosts is set
+var ErrControllerOtherHost = errors.New("managed controller is on another host than the operations center, " +
+	"set execution.opscenter.otherhosts to discover it with the credentials of the account")
+
+// opsCenterItem is an item of an operations center, either a controller or a folder holding controllers
+type opsCenterItem struct {
+	Class string `json:"_class"`
+	Name  string `json:"name"`
+	// Endpoint is the URL of a controller, empty until the controller is provisioned or connected
+	Endpoint string           `json:"endpoint"`
+	Jobs     []*opsCenterItem `json:"jobs"`
+}
+
+// managedController is a controller connected to the operations center of the account
+type managedController struct {
+	// name is the full name of the controller item in the operations center
+	name     string
+	endpoint string
+	// identifiers are the requested asset identifiers living on the controller
+	identifiers []string
+}
+
+// listManagedControllers returns the controllers managed by the operations center of the account, none
+// when the account points at a controller. Controllers may be organized in folders.
+func listManagedControllers(ctx context.Context, jenkins *gojenkins.Jenkins) ([]*managedController, error) {
+	root := new(opsCenterItem)
+	depth := viper.GetInt("discovery.tree.depth")
+	item := opsCenterItemFields
+	for i := 1; i < depth; i++ {
+		item = opsCenterItemFields + ",jobs[" + item + "]"
+	}
+	query := map[string]string{
+		"tree": "jobs[" + item + "]",
+	}
+	if err := getJSON(ctx, jenkins, "/", root, query); err != nil {
+		return nil, err
+	}
+	return managedControllers(root.Jobs, nil), nil
+}
+
+func managedControllers(items []*opsCenterItem, parents []string) []*managedController {
+	var controllers []*managedController
+	for _, item := range items {
+		path := append(append([]string{}, parents...), item.Name)
+		if managedControllerClasses[item.Class] {
+			if len(item.Endpoint) > 0 {
+				controllers = append(controllers, &managedController{
+					name:     strings.Join(path, "/"),
+					endpoint: strings.TrimRight(item.Endpoint, "/"),
+				})
+			}
+			continue
+		}
+		controllers = append(controllers, managedControllers(item.Jobs, path)...)
+	}
+	return controllers
+}
+
+// assignIdentifiers hands the requested identifiers living on a managed controller to that controller and
+// returns the others, which live on the controller of the account. Controllers may share a host, an
+// identifier goes to the controller with the longest matching URL.
+func assignIdentifiers(identifiers []string, controllers []*managedController) []string {
+	var remaining []string
+	for _, identifier := range identifiers {
+		var owner *managedController
+		for _, controller := range controllers {
+			if _, ok := relativePath(controller.endpoint, identifier); ok && (owner == nil || len(controller.endpoint) > len(owner.endpoint)) {
+				owner = controller
+			}
+		}
+		if owner == nil {
+			remaining = append(remaining, identifier)
+			continue
+		}
+		owner.identifiers = append(owner.identifiers, identifier)
+	}
+	return remaining
+}
+
+// executeManagedControllers discovers the assets of every managed controller with the credentials of the
+// account, relying on the single sign-on of the operations center. Controllers that cannot be reached are
+// reported as failed controller assets, the others are still discovered.
+func (cs *jenkinsMasterService) executeManagedControllers(ctx context.Context, creds *jenkinsCreds, controllers []*managedController, req *service.ExecuteRequest, responses *responseStream, requestId string) error {
+	for _, controller := range controllers {
+		if len(req.AssetIdentifiers) > 0 && len(controller.identifiers) == 0 {
+			continue
+		}
+		log.Debug(requestId).Msgf("Discovering managed controller %s at %s", controller.name, controller.endpoint)
+		err := cs.executeManagedController(ctx, creds, controller, req.Account, responses, requestId)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Error(requestId).Err(err).Msgf("Unable to discover managed controller %s", controller.name)
+		identifier, idErr := controllerIdentifier(controller.endpoint)
+		if idErr != nil {
+			identifier = controller.endpoint
+		}
+		// managed controllers run CloudBees CI
+		if err := responses.forController(nil, controller.endpoint, FlavorCBCI).failAsset(AssetTypeController, FlavorCBCI, identifier, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeManagedController discovers the assets of a managed controller. The transport of the credentials is
+// cloned for it, as it pools connections per host and may override the server name of the operations center.
+func (cs *jenkinsMasterService) executeManagedController(ctx context.Context, creds *jenkinsCreds, controller *managedController, account *domain.Account, responses *responseStream, requestId string) error {
+	if !onAccountHost(creds.URL, controller.endpoint) && !viper.GetBool("execution.opscenter.otherhosts") {
+		return ErrControllerOtherHost
+	}
+	controllerCreds := *creds
+	controllerCreds.transport = endpointTransport(creds.transport)
+	defer closeIdleConnections(controllerCreds.transport)
+	jenkins := newJenkins(ctx, controller.endpoint, &controllerCreds)
+	if _, err := jenkins.Init(ctx); err != nil {
+		return err
+	}
+	info, err := cs.describeController(ctx, account.Uuid, jenkins, requestId)
+	if err != nil {
+		log.Warn(requestId).Err(err).Msgf("Unable to get the root URL of managed controller %s", controller.name)
+	}
+	urls := newRootURLMapping(jenkins.Server, info.rootURL, requestId)
+	child := responses.forController(urls, jenkins.Server, info.flavor)
+	return cs.executeController(ctx, jenkins, info, managedControllerMetadata(account.Metadata, requestId), controller.identifiers, child, false, requestId)
+}
+
+// managedControllerMetadata returns the account metadata applying to a managed controller. The selected items
+// and views were found on the operations center when the account was validated and mean nothing on a managed
+// controller, which gets every pipeline selected unless include patterns narrow them down. Exclude patterns
+// and nodes apply as is. Recorded items are dropped as well, so renames are not tracked, see entryRecorder.
+func managedControllerMetadata(metadata []byte, requestId string) []byte {
+	config, err := parseAccountConfig(metadata)
+	if err != nil || config == nil {
+		return metadata
+	}
+	config.Pipelines = nil
+	config.Views = nil
+	config.Items = nil
+	if len(config.Include) == 0 {
+		config.Include = []string{"**"}
+	}
+	managed, err := json.Marshal(config)
+	if err != nil {
+		log.Warn(requestId).Err(err).Msg("Unable to select the pipelines of a managed controller")
+		return metadata
+	}
+	return managed
+}
+
+// onAccountHost reports whether a managed controller endpoint is on the host of the account URL
+func onAccountHost(accountURL string, endpoint string) bool {
+	account, err := url.Parse(strings.TrimSpace(accountURL))
+	if err != nil {
+		return false
+	}
+	controller, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(account.Scheme, controller.Scheme) && sameHost(account, controller)
+}
@@ -0,0 +1,143 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+)
+
+func Test_managedControllers(t *testing.T) {
+	root := new(opsCenterItem)
+	data := `{"jobs":[
+		{"_class":"com.cloudbees.opscenter.server.model.ManagedMaster","name":"team-a","endpoint":"https://cbci.example.com/team-a/"},
+		{"_class":"com.cloudbees.hudson.plugins.folder.Folder","name":"legacy","jobs":[
+			{"_class":"com.cloudbees.opscenter.server.model.ClientMaster","name":"old","endpoint":"https://old.example.com"},
+			{"_class":"com.cloudbees.opscenter.server.model.ClientMaster","name":"pending","endpoint":""}
+		]},
+		{"_class":"org.jenkinsci.plugins.workflow.job.WorkflowJob","name":"housekeeping"}
+	]}`
+	if err := json.Unmarshal([]byte(data), root); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	got := managedControllers(root.Jobs, nil)
+	want := []*managedController{
+		{name: "team-a", endpoint: "https://cbci.example.com/team-a"},
+		{name: "legacy/old", endpoint: "https://old.example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("managedControllers() = %v, want %v", got, want)
+	}
+}
+
+func Test_assignIdentifiers(t *testing.T) {
+	controllers := []*managedController{
+		{name: "team-a", endpoint: "https://cbci.example.com/team-a"},
+		{name: "team-a-ext", endpoint: "https://cbci.example.com/team-a/ext"},
+		{name: "old", endpoint: "https://old.example.com"},
+	}
+	identifiers := []string{
+		"https://cbci.example.com/team-a/job/app/",
+		"https://cbci.example.com/team-a/ext/job/app/",
+		"https://OLD.example.com:443/computer/linux/",
+		"https://cbci.example.com/cjoc/job/housekeeping/",
+		"https://cbci.example.com/team-ab/job/app/",
+	}
+	remaining := assignIdentifiers(identifiers, controllers)
+	want := []string{
+		"https://cbci.example.com/cjoc/job/housekeeping/",
+		"https://cbci.example.com/team-ab/job/app/",
+	}
+	if !reflect.DeepEqual(remaining, want) {
+		t.Errorf("assignIdentifiers() = %v, want %v", remaining, want)
+	}
+	wantAssigned := [][]string{
+		{"https://cbci.example.com/team-a/job/app/"},
+		{"https://cbci.example.com/team-a/ext/job/app/"},
+		{"https://OLD.example.com:443/computer/linux/"},
+	}
+	for i, controller := range controllers {
+		if !reflect.DeepEqual(controller.identifiers, wantAssigned[i]) {
+			t.Errorf("assignIdentifiers() assigned %v to %s, want %v", controller.identifiers, controller.name, wantAssigned[i])
+		}
+	}
+}
+
+func Test_managedControllerMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      AccountConfig
+		wantInclude []string
+	}{
+		{
+			name: "Operations_Center_Selection",
+			config: AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"oc-job"},
+				Views:     []string{"All"},
+				Exclude:   []string{"**/scratch"},
+				Items:     []*ItemMetadata{{Path: "oc-job", Class: JobClassPipeline}},
+			},
+			wantInclude: []string{"**"},
+		},
+		{
+			name:        "Include_Patterns",
+			config:      AccountConfig{Version: MetadataVersion, Include: []string{"team-a/**"}, Exclude: []string{"**/scratch"}},
+			wantInclude: []string{"team-a/**"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := encodeAccountConfig(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseAccountConfig(managedControllerMetadata(metadata, "test"))
+			if err != nil {
+				t.Fatalf("parseAccountConfig() error = %v", err)
+			}
+			if len(got.Pipelines) > 0 || len(got.Views) > 0 || len(got.Items) > 0 {
+				t.Errorf("managedControllerMetadata() = %+v, want no selected items", got)
+			}
+			if !reflect.DeepEqual(got.Include, tt.wantInclude) || !reflect.DeepEqual(got.Exclude, tt.config.Exclude) {
+				t.Errorf("managedControllerMetadata() include = %v, exclude = %v, want %v, %v", got.Include, got.Exclude, tt.wantInclude, tt.config.Exclude)
+			}
+		})
+	}
+}
+
+func Test_onAccountHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     bool
+	}{
+		{name: "Context_Path", endpoint: "https://cbci.example.com/team-a", want: true},
+		{name: "Host_Case_And_Default_Port", endpoint: "https://CBCI.example.com:443/team-a", want: true},
+		{name: "Other_Host", endpoint: "https://old.example.com", want: false},
+		{name: "Other_Port", endpoint: "https://cbci.example.com:8443/team-a", want: false},
+		{name: "Other_Scheme", endpoint: "http://cbci.example.com/team-a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onAccountHost("https://cbci.example.com/cjoc/", tt.endpoint); got != tt.want {
+				t.Errorf("onAccountHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_executeManagedController_otherHost(t *testing.T) {
+	creds := &jenkinsCreds{Type: CredTypeBearer, URL: "https://cbci.example.com/cjoc/", Token: "secret"}
+	controller := &managedController{name: "legacy/old", endpoint: "https://old.example.com"}
+	responses := newResponseStream(nil, nil, "test")
+
+	cs := &jenkinsMasterService{}
+	err := cs.executeManagedController(context.Background(), creds, controller, &domain.Account{}, responses, "test")
+	if !errors.Is(err, ErrControllerOtherHost) {
+		t.Errorf("executeManagedController() error = %v, want %v", err, ErrControllerOtherHost)
+	}
+}
@@ -0,0 +1,99 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+)
+
+// config.xml elements holding the organization an SCM navigator scans,
+// e.g. GitHub and Bitbucket use repoOwner, GitLab uses projectOwner
+var scmOwnerElements = map[string]bool{
+	"repoOwner":    true,
+	"projectOwner": true,
+}
+
+// getOrganizationJobs returns the branch jobs of every repository project in an organization folder
+func (cs *jenkinsMasterService) getOrganizationJobs(ctx context.Context, org *gojenkins.Job) ([]*pipelineJob, error) {
+	owner := getSCMOwner(ctx, org)
+	projects := org.Raw.Jobs
+	return collect(ctx, len(projects), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		project, err := fetchInnerJob(ctx, org, projects[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		if GetJobClass(project.Raw.Class) != JobClassMultiBranch {
+			return nil, nil
+		}
+		branchJobs, err := cs.getBranchJobs(ctx, project)
+		assignOrganization(branchJobs, org, owner, project.GetName())
+		return branchJobs, err
+	})
+}
+
+// setOrganization records the organization folder of a multibranch project on its branch jobs, if it has one
+func (cs *jenkinsMasterService) setOrganization(ctx context.Context, mb *gojenkins.Job, pipelines []*pipelineJob) error {
+	org, err := getParentJob(ctx, mb)
+	if err != nil {
+		return err
+	}
+	if org == nil || GetJobClass(org.Raw.Class) != JobClassOrganization {
+		return nil
+	}
+
+	assignOrganization(pipelines, org, getSCMOwner(ctx, org), mb.GetName())
+	return nil
+}
+
+func assignOrganization(pipelines []*pipelineJob, org *gojenkins.Job, owner string, repository string) {
+	orgName := jobFullName(org)
+	for _, pipeline := range pipelines {
+		pipeline.organization = orgName
+		pipeline.scmOrganization = owner
+		pipeline.scmRepository = repository
+	}
+}
+
+// getSCMOwner returns the SCM organization scanned by an organization folder. Reading the
+// configuration needs extended read permission, so the folder name is used when it is not available.
+func getSCMOwner(ctx context.Context, org *gojenkins.Job) string {
+	var config string
+	err := withSlot(ctx, func() (err error) {
+		config, err = org.GetConfig(ctx)
+		return err
+	})
+	if err != nil {
+		log.Debug().Err(err).Msgf("Unable to read configuration of organization folder %s", org.Base)
+		return org.GetName()
+	}
+	if owner := scmOwnerFromConfig(config); len(owner) > 0 {
+		return owner
+	}
+	return org.GetName()
+}
+
+func scmOwnerFromConfig(config string) string {
+	// Jenkins declares XML 1.1 which encoding/xml refuses to parse
+	if strings.HasPrefix(config, "<?xml") {
+		if end := strings.Index(config, "?>"); end >= 0 {
+			config = config[end+2:]
+		}
+	}
+	decoder := xml.NewDecoder(strings.NewReader(config))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if element, ok := token.(xml.StartElement); ok && scmOwnerElements[element.Name.Local] {
+			var owner string
+			if err := decoder.DecodeElement(&owner, &element); err != nil {
+				return ""
+			}
+			return strings.TrimSpace(owner)
+		}
+	}
+}
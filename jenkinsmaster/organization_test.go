@@ -0,0 +1,53 @@
+package jenkinsmaster
+
+import "testing"
+
+func Test_scmOwnerFromConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name: "GitHub",
+			config: `<?xml version='1.1' encoding='UTF-8'?>
+<jenkins.branch.OrganizationFolder plugin="branch-api@2.1046">
+  <navigators>
+    <org.jenkinsci.plugins.github__branch__source.GitHubSCMNavigator plugin="github-branch-source@1703">
+      <repoOwner>cloudbees</repoOwner>
+      <credentialsId>github</credentialsId>
+    </org.jenkinsci.plugins.github__branch__source.GitHubSCMNavigator>
+  </navigators>
+</jenkins.branch.OrganizationFolder>`,
+			want: "cloudbees",
+		},
+		{
+			name: "GitLab",
+			config: `<jenkins.branch.OrganizationFolder>
+  <navigators>
+    <io.jenkins.plugins.gitlabbranchsource.GitLabSCMNavigator>
+      <projectOwner> compliance </projectOwner>
+    </io.jenkins.plugins.gitlabbranchsource.GitLabSCMNavigator>
+  </navigators>
+</jenkins.branch.OrganizationFolder>`,
+			want: "compliance",
+		},
+		{
+			name:   "No_Navigator",
+			config: `<jenkins.branch.OrganizationFolder><navigators/></jenkins.branch.OrganizationFolder>`,
+			want:   "",
+		},
+		{
+			name:   "Invalid_XML",
+			config: `<jenkins.branch.OrganizationFolder><navigators>`,
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scmOwnerFromConfig(tt.config); got != tt.want {
+				t.Errorf("scmOwnerFromConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package jenkinsmaster
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var ErrInvalidProxy = errors.New("invalid proxy configuration")
+
+// proxySchemes are the proxy URL schemes the transport can connect through
+var proxySchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks5": true,
+}
+
+// proxyFunc returns the proxy selection of the credentials: every request goes through the proxy at
+// proxyUrl, authenticating with proxyUser and proxyPassword when set, unless its host is in the noProxy
+// list, e.g. jenkins.internal, .example.com, 10.0.0.0/8 or *. Credentials without a proxy URL keep the
+// process-wide environment proxies.
+func proxyFunc(creds *jenkinsCreds) (func(*http.Request) (*url.URL, error), error) {
+	if len(creds.ProxyURL) == 0 {
+		if len(creds.ProxyUser) > 0 || len(creds.ProxyPassword) > 0 || len(creds.NoProxy) > 0 {
+			return nil, fmt.Errorf("%w: proxyUser, proxyPassword and noProxy need proxyUrl", ErrInvalidProxy)
+		}
+		return nil, nil
+	}
+	proxy, err := url.Parse(creds.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProxy, err)
+	}
+	if !proxySchemes[proxy.Scheme] || len(proxy.Host) == 0 {
+		return nil, fmt.Errorf("%w: proxyUrl must be an http, https or socks5 URL with a host", ErrInvalidProxy)
+	}
+	if len(creds.ProxyUser) > 0 {
+		proxy.User = url.UserPassword(creds.ProxyUser, creds.ProxyPassword)
+	}
+	config := httpproxy.Config{
+		HTTPProxy:  proxy.String(),
+		HTTPSProxy: proxy.String(),
+		NoProxy:    strings.Join(creds.NoProxy, ","),
+	}
+	selectProxy := config.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return selectProxy(r.URL)
+	}, nil
+}
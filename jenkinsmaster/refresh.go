@@ -0,0 +1,282 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// entryRecorder records the full name and metadata item of every discovered pipeline before handing
+// the pipelines on, so that the account metadata can be reconciled with the controller. Pipelines found
+// under another path than their fingerprint was recorded with are marked as renamed or moved. Renames are
+// only tracked this way, by the full discovery reconciling the items recorded in the account metadata:
+// pipelines requested by identifier and pipelines of managed controllers, whose account metadata records
+// no items, are sent without previous identifier.
+type entryRecorder struct {
+	pipelineSink
+	mu    sync.Mutex
+	names map[string]bool
+	seen  map[string]bool
+	items []*ItemMetadata
+	// accept tells the pipelines selected by the account configuration, see fingerprint
+	accept func(name string) bool
+	// recorded holds the items recorded by the last refresh by path
+	recorded      map[string]*ItemMetadata
+	recordedItems []*ItemMetadata
+	// previous holds the items recorded by the last refresh by fingerprint
+	previous map[string]*ItemMetadata
+	// renamed maps the previous path of renamed or moved pipelines to their current path
+	renamed map[string]string
+	// held are the pipelines that may have been renamed or moved with their first builds discarded, see finish
+	held []*pipelineJob
+}
+
+func newEntryRecorder(sink pipelineSink, previousItems []*ItemMetadata, accept func(name string) bool) *entryRecorder {
+	recorded := map[string]*ItemMetadata{}
+	previous := map[string]*ItemMetadata{}
+	for _, item := range previousItems {
+		recorded[item.Path] = item
+		if len(item.Fingerprint) > 0 {
+			previous[item.Fingerprint] = item
+		}
+	}
+	return &entryRecorder{
+		pipelineSink:  sink,
+		names:         map[string]bool{},
+		seen:          map[string]bool{},
+		accept:        accept,
+		recorded:      recorded,
+		recordedItems: previousItems,
+		previous:      previous,
+		renamed:       map[string]string{},
+	}
+}
+
+func (r *entryRecorder) send(ctx context.Context, pipelines []*pipelineJob) error {
+	var items []*ItemMetadata
+	for _, pipeline := range pipelines {
+		item := metadataItem(pipeline)
+		if item.Class == JobClassPipeline && viper.GetBool("execution.track.renames") {
+			fingerprint, err := r.fingerprint(ctx, pipeline, item.Path)
+			if err != nil {
+				return err
+			}
+			item.Fingerprint = fingerprint
+		}
+		items = append(items, item)
+	}
+
+	r.mu.Lock()
+	var ready []*pipelineJob
+	for i, pipeline := range pipelines {
+		r.names[jobFullName(pipeline.Job)] = true
+		item := items[i]
+		if !r.seen[item.Path] {
+			r.seen[item.Path] = true
+			r.items = append(r.items, item)
+		}
+		if previous, ok := r.previous[item.Fingerprint]; ok && len(item.Fingerprint) > 0 && previous.Path != item.Path {
+			pipeline.renamedFrom(previous)
+			r.renamed[previous.Path] = item.Path
+		} else if len(item.Fingerprint) > 0 && !ok && r.recorded[item.Path] == nil && len(r.previous) > 0 {
+			// whether it is a pipeline whose first builds were discarded is known once every pipeline was found
+			r.held = append(r.held, pipeline)
+			continue
+		}
+		ready = append(ready, pipeline)
+	}
+	r.mu.Unlock()
+	return r.pipelineSink.send(ctx, ready)
+}
+
+// finish hands on the pipelines held back by send once discovery is over. When it is complete, those
+// matched with a recorded pipeline whose first builds were discarded are marked as renamed or moved first,
+// see renamedPaths. Otherwise every pipeline not reached would be taken for gone, so none is.
+func (r *entryRecorder) finish(ctx context.Context, complete bool) error {
+	r.mu.Lock()
+	held := r.held
+	r.held = nil
+	if complete {
+		renamedFrom := map[string]*ItemMetadata{}
+		for path, to := range r.renamedPaths(r.recordedItems, r.recorded) {
+			renamedFrom[to] = r.recorded[path]
+		}
+		for _, pipeline := range held {
+			if previous, ok := renamedFrom[jobFullName(pipeline.Job)]; ok {
+				pipeline.renamedFrom(previous)
+			}
+		}
+	}
+	r.mu.Unlock()
+	if len(held) == 0 {
+		return nil
+	}
+	return r.pipelineSink.send(ctx, held)
+}
+
+// fingerprint returns the fingerprint of a pipeline found at path. Walking folders polls jobs without their
+// first build, which takes an extra call per pipeline, so only the pipelines selected or found at a new path,
+// which may have been renamed or moved there, are fetched. The others keep the fingerprint recorded last.
+func (r *entryRecorder) fingerprint(ctx context.Context, pipeline *pipelineJob, path string) (string, error) {
+	recorded, ok := r.recorded[path]
+	if ok && !pipeline.buildsKnown && r.accept != nil && !r.accept(path) {
+		return recorded.Fingerprint, nil
+	}
+	if err := fetchBuilds(ctx, pipeline); err != nil && ctx.Err() != nil {
+		return "", err
+	}
+	return pipeline.fingerprint, nil
+}
+
+// accountRefresh is the outcome of reconciling the saved account configuration with the controller
+type accountRefresh struct {
+	config  AccountConfig
+	added   []string
+	removed []string
+	// renamed maps the previous path of the selected pipelines that were renamed or moved to their current path
+	renamed map[string]string
+	// knownChanged is set when items were created, deleted or changed, whether selected or not,
+	// or the metadata was written in an older version or requested the refresh
+	knownChanged bool
+}
+
+func (r *accountRefresh) changed() bool {
+	return len(r.added) > 0 || len(r.removed) > 0 || len(r.renamed) > 0 || r.knownChanged
+}
+
+// refreshAccountConfig reconciles the selected entries of config with the pipelines found on the controller.
+// Entries selecting no pipeline any more are removed and items created since the last refresh are added
+// unless excluded by filter. Selected pipelines that were renamed or moved stay selected under their
+// current path. Configurations saved before items were recorded get them recorded only, since new items
+// cannot be told apart from items left out on purpose. Items found for the first time are stamped with now.
+func (r *entryRecorder) refreshAccountConfig(config *AccountConfig, filter *pipelineFilter, now time.Time) *accountRefresh {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known := map[string]*ItemMetadata{}
+	for _, item := range config.Items {
+		known[item.Path] = item
+	}
+	renamed := r.renamedPaths(config.Items, known)
+
+	refresh := &accountRefresh{config: *config, renamed: map[string]string{}}
+	refresh.config.Version = MetadataVersion
+	refresh.config.Refresh = false
+	refresh.config.Pipelines = nil
+	for _, entry := range config.Pipelines {
+		if r.selectsAny(entry) {
+			refresh.config.Pipelines = append(refresh.config.Pipelines, entry)
+		} else if path, ok := renamed[entry]; ok {
+			refresh.renamed[entry] = path
+			refresh.config.Pipelines = append(refresh.config.Pipelines, path)
+		} else {
+			refresh.removed = append(refresh.removed, entry)
+		}
+	}
+	renamedTo := map[string]bool{}
+	for _, path := range renamed {
+		renamedTo[path] = true
+	}
+
+	// fingerprints change as builds are discarded, which alone is not worth writing the metadata back for
+	refresh.knownChanged = config.Version != MetadataVersion || config.Refresh || len(known) != len(r.items)
+	for _, item := range r.items {
+		previous, ok := known[item.Path]
+		refresh.knownChanged = refresh.knownChanged || !ok || *previous != ItemMetadata{
+			Path:         item.Path,
+			URL:          item.URL,
+			Class:        item.Class,
+			DiscoveredAt: previous.DiscoveredAt,
+			Fingerprint:  previous.Fingerprint,
+		}
+	}
+
+	if len(config.Items) > 0 {
+		selected := &pipelineFilter{selected: refresh.config.Pipelines}
+		for _, item := range r.items {
+			// a renamed pipeline left out of the selection stays out of it
+			if known[item.Path] != nil || renamedTo[item.Path] || selected.isSelected(item.Path) || filter.isExcluded(item.Path) {
+				continue
+			}
+			refresh.added = append(refresh.added, item.Path)
+			refresh.config.Pipelines = append(refresh.config.Pipelines, item.Path)
+		}
+	}
+
+	refresh.config.Items = nil
+	for _, item := range r.items {
+		copied := *item
+		refresh.config.Items = append(refresh.config.Items, &copied)
+	}
+	// renamed pipelines keep when they were first discovered
+	previous := append([]*ItemMetadata{}, config.Items...)
+	for _, item := range config.Items {
+		if path, ok := renamed[item.Path]; ok && !r.seen[item.Path] {
+			previous = append(previous, &ItemMetadata{Path: path, DiscoveredAt: item.DiscoveredAt})
+		}
+	}
+	stampItems(refresh.config.Items, previous, now)
+	return refresh
+}
+
+// renamedPaths returns the previous path of the pipelines renamed or moved since the last refresh by their
+// current path. On top of the pipelines found with their recorded fingerprint, a pipeline recorded under
+// a path that is gone is matched with the one pipeline at a new path that may have had its first builds
+// discarded since, provided no other pipeline may be it either.
+func (r *entryRecorder) renamedPaths(previousItems []*ItemMetadata, known map[string]*ItemMetadata) map[string]string {
+	renamed := map[string]string{}
+	renamedTo := map[string]bool{}
+	for path, to := range r.renamed {
+		renamed[path] = to
+		renamedTo[to] = true
+	}
+
+	var gone, found []*ItemMetadata
+	for _, item := range previousItems {
+		if item.Class == JobClassPipeline && len(item.Fingerprint) > 0 && !r.seen[item.Path] && len(renamed[item.Path]) == 0 {
+			gone = append(gone, item)
+		}
+	}
+	for _, item := range r.items {
+		if _, ok := r.previous[item.Fingerprint]; len(item.Fingerprint) > 0 && !ok && known[item.Path] == nil && !renamedTo[item.Path] {
+			found = append(found, item)
+		}
+	}
+	for _, previous := range gone {
+		var matches []*ItemMetadata
+		for _, item := range found {
+			if rotatedFrom(previous.Fingerprint, item.Fingerprint) {
+				matches = append(matches, item)
+			}
+		}
+		if len(matches) != 1 {
+			continue
+		}
+		claims := 0
+		for _, other := range gone {
+			if rotatedFrom(other.Fingerprint, matches[0].Fingerprint) {
+				claims++
+			}
+		}
+		if claims == 1 {
+			renamed[previous.Path] = matches[0].Path
+		}
+	}
+	return renamed
+}
+
+// selectsAny reports whether an entry selects a discovered pipeline, either the pipeline itself or a folder containing it
+func (r *entryRecorder) selectsAny(entry string) bool {
+	if r.names[entry] {
+		return true
+	}
+	for name := range r.names {
+		if strings.HasPrefix(name, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
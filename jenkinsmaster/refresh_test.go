@@ -0,0 +1,385 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bndr/gojenkins"
+	"github.com/spf13/viper"
+)
+
+type discardSink struct{}
+
+func (discardSink) send(context.Context, []*pipelineJob) error { return nil }
+func (discardSink) fail(string, error) error                   { return nil }
+
+func Test_entryRecorder_refreshAccountConfig(t *testing.T) {
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	pipeline := func(base string, multiBranch string) *pipelineJob {
+		return &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Base: base}, multiBranch: multiBranch}
+	}
+	live := []*pipelineJob{
+		pipeline("/job/standalone", ""),
+		pipeline("/job/team-a/job/deploy", ""),
+		pipeline("/job/team-a/job/app/job/main", "team-a/app"),
+		pipeline("/job/team-a/job/app/job/PR-1", "team-a/app"),
+		pipeline("/job/new", ""),
+		pipeline("/job/scratch", ""),
+	}
+	discovered := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	item := func(path string, class string) *ItemMetadata {
+		return &ItemMetadata{Path: path, URL: nameIdentifier(jenkins, path), Class: class, DiscoveredAt: discovered}
+	}
+	knownItems := []*ItemMetadata{
+		item("standalone", JobClassPipeline),
+		item("team-a/deploy", JobClassPipeline),
+		item("team-a/app/main", JobClassPipeline),
+		item("team-a/app/PR-1", JobClassPipeline),
+		item("new", JobClassPipeline),
+		item("scratch", JobClassPipeline),
+	}
+
+	tests := []struct {
+		name          string
+		config        AccountConfig
+		exclude       []string
+		wantPipelines []string
+		wantAdded     []string
+		wantRemoved   []string
+		wantChanged   bool
+		wantNew       []string
+	}{
+		{
+			name: "Up_To_Date",
+			config: AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"standalone", "team-a"},
+				Items:     knownItems,
+			},
+			wantPipelines: []string{"standalone", "team-a"},
+		},
+		{
+			// the request is cleared even when nothing else changed
+			name: "Refresh_Requested",
+			config: AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"standalone", "team-a"},
+				Items:     knownItems,
+				Refresh:   true,
+			},
+			wantPipelines: []string{"standalone", "team-a"},
+			wantChanged:   true,
+		},
+		{
+			name: "Added_And_Removed",
+			config: AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"standalone", "team-a/app", "gone"},
+				Items:     []*ItemMetadata{knownItems[0], knownItems[1], knownItems[2], knownItems[3], item("gone", JobClassPipeline)},
+			},
+			exclude:       []string{"scratch"},
+			wantPipelines: []string{"standalone", "team-a/app", "new"},
+			wantAdded:     []string{"new"},
+			wantRemoved:   []string{"gone"},
+			wantChanged:   true,
+			wantNew:       []string{"new", "scratch"},
+		},
+		{
+			name: "Legacy_Records_Items_Only",
+			config: AccountConfig{
+				Pipelines: []string{"standalone"},
+			},
+			wantPipelines: []string{"standalone"},
+			wantChanged:   true,
+			wantNew:       []string{"standalone", "team-a/deploy", "team-a/app/main", "team-a/app/PR-1", "new", "scratch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newPipelineFilter(&AccountConfig{Exclude: tt.exclude})
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := newEntryRecorder(discardSink{}, tt.config.Items, nil)
+			if err := recorder.send(context.Background(), live); err != nil {
+				t.Fatal(err)
+			}
+			got := recorder.refreshAccountConfig(&tt.config, filter, now)
+			if !reflect.DeepEqual(got.config.Pipelines, tt.wantPipelines) {
+				t.Errorf("refreshAccountConfig() pipelines = %v, want %v", got.config.Pipelines, tt.wantPipelines)
+			}
+			if !reflect.DeepEqual(got.added, tt.wantAdded) || !reflect.DeepEqual(got.removed, tt.wantRemoved) {
+				t.Errorf("refreshAccountConfig() added = %v, removed = %v, want %v, %v", got.added, got.removed, tt.wantAdded, tt.wantRemoved)
+			}
+			if got.changed() != tt.wantChanged {
+				t.Errorf("refreshAccountConfig() changed = %v, want %v", got.changed(), tt.wantChanged)
+			}
+			if got.config.Version != MetadataVersion || got.config.Refresh {
+				t.Errorf("refreshAccountConfig() version = %v, refresh = %v, want %v without refresh", got.config.Version, got.config.Refresh, MetadataVersion)
+			}
+
+			var paths, stampedNow []string
+			for _, item := range got.config.Items {
+				paths = append(paths, item.Path)
+				if item.DiscoveredAt.Equal(now) {
+					stampedNow = append(stampedNow, item.Path)
+				}
+			}
+			if want := []string{"standalone", "team-a/deploy", "team-a/app/main", "team-a/app/PR-1", "new", "scratch"}; !reflect.DeepEqual(paths, want) {
+				t.Errorf("refreshAccountConfig() items = %v, want %v", paths, want)
+			}
+			if !reflect.DeepEqual(stampedNow, tt.wantNew) {
+				t.Errorf("refreshAccountConfig() items first discovered now = %v, want %v", stampedNow, tt.wantNew)
+			}
+		})
+	}
+}
+
+func Test_entryRecorder_renamed(t *testing.T) {
+	viper.Set("execution.track.renames", true)
+	defer viper.Set("execution.track.renames", nil)
+
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	discovered := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	config := &AccountConfig{
+		Version:   MetadataVersion,
+		Pipelines: []string{"team-a/deploy", "team-a/build"},
+		Items: []*ItemMetadata{
+			{Path: "team-a/deploy", URL: "https://jenkins/job/team-a/job/deploy/", Class: JobClassPipeline, DiscoveredAt: discovered, Fingerprint: "1@100"},
+			{Path: "team-a/build", URL: "https://jenkins/job/team-a/job/build/", Class: JobClassPipeline, DiscoveredAt: discovered, Fingerprint: "1@200"},
+			{Path: "scratch", URL: "https://jenkins/job/scratch/", Class: JobClassPipeline, DiscoveredAt: discovered, Fingerprint: "1@300"},
+		},
+	}
+	live := []*pipelineJob{
+		// moved to another folder
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: "/job/team-b/job/deploy"}, fingerprint: "1@100", buildsKnown: true},
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: "/job/team-a/job/build"}, fingerprint: "1@200", buildsKnown: true},
+		// renamed, but was never selected
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: "/job/sandbox"}, fingerprint: "1@300", buildsKnown: true},
+	}
+
+	recorder := newEntryRecorder(discardSink{}, config.Items, nil)
+	if err := recorder.send(context.Background(), live); err != nil {
+		t.Fatal(err)
+	}
+	if got := toMasterResponse(live[0], FlavorCBCI).Asset.Attributes[AttrPreviousIdentifier]; got != "https://jenkins/job/team-a/job/deploy/" {
+		t.Errorf("toMasterResponse() previous identifier = %v", got)
+	}
+	if got := toMasterResponse(live[1], FlavorCBCI).Asset.Attributes[AttrPreviousIdentifier]; len(got) > 0 {
+		t.Errorf("toMasterResponse() previous identifier = %v, want none", got)
+	}
+
+	got := recorder.refreshAccountConfig(config, &pipelineFilter{}, now)
+	if want := []string{"team-b/deploy", "team-a/build"}; !reflect.DeepEqual(got.config.Pipelines, want) {
+		t.Errorf("refreshAccountConfig() pipelines = %v, want %v", got.config.Pipelines, want)
+	}
+	if want := map[string]string{"team-a/deploy": "team-b/deploy"}; !reflect.DeepEqual(got.renamed, want) {
+		t.Errorf("refreshAccountConfig() renamed = %v, want %v", got.renamed, want)
+	}
+	if len(got.added) > 0 || len(got.removed) > 0 {
+		t.Errorf("refreshAccountConfig() added = %v, removed = %v, want none", got.added, got.removed)
+	}
+	for _, item := range got.config.Items {
+		if !item.DiscoveredAt.Equal(discovered) {
+			t.Errorf("refreshAccountConfig() item %v discovered at %v, want %v", item.Path, item.DiscoveredAt, discovered)
+		}
+	}
+}
+
+func Test_entryRecorder_rotated(t *testing.T) {
+	viper.Set("execution.track.renames", true)
+	defer viper.Set("execution.track.renames", nil)
+
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	discovered := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	item := func(path string, fingerprint string) *ItemMetadata {
+		return &ItemMetadata{Path: path, URL: nameIdentifier(jenkins, path), Class: JobClassPipeline, DiscoveredAt: discovered, Fingerprint: fingerprint}
+	}
+	pipeline := func(base string, fingerprint string) *pipelineJob {
+		return &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: base}, fingerprint: fingerprint, buildsKnown: true}
+	}
+
+	tests := []struct {
+		name        string
+		items       []*ItemMetadata
+		live        []*pipelineJob
+		wantRenamed map[string]string
+		wantChanged bool
+	}{
+		{
+			name:        "Builds_Discarded",
+			items:       []*ItemMetadata{item("team-a/deploy", "1@100")},
+			live:        []*pipelineJob{pipeline("/job/team-a/job/deploy", "4@400")},
+			wantRenamed: map[string]string{},
+		},
+		{
+			name:        "Builds_Discarded_And_Moved",
+			items:       []*ItemMetadata{item("team-a/deploy", "1@100")},
+			live:        []*pipelineJob{pipeline("/job/team-b/job/deploy", "4@400"), pipeline("/job/fresh", "1@500")},
+			wantRenamed: map[string]string{"team-a/deploy": "team-b/deploy"},
+			wantChanged: true,
+		},
+		{
+			name:        "Ambiguous",
+			items:       []*ItemMetadata{item("team-a/deploy", "1@100")},
+			live:        []*pipelineJob{pipeline("/job/team-b/job/deploy", "4@400"), pipeline("/job/team-c/job/deploy", "6@600")},
+			wantRenamed: map[string]string{},
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &AccountConfig{Version: MetadataVersion, Pipelines: []string{"team-a/deploy"}, Items: tt.items}
+			recorder := newEntryRecorder(discardSink{}, config.Items, nil)
+			if err := recorder.send(context.Background(), tt.live); err != nil {
+				t.Fatal(err)
+			}
+			got := recorder.refreshAccountConfig(config, &pipelineFilter{}, now)
+			if !reflect.DeepEqual(got.renamed, tt.wantRenamed) {
+				t.Errorf("refreshAccountConfig() renamed = %v, want %v", got.renamed, tt.wantRenamed)
+			}
+			if got.changed() != tt.wantChanged {
+				t.Errorf("refreshAccountConfig() changed = %v, want %v", got.changed(), tt.wantChanged)
+			}
+		})
+	}
+}
+
+func Test_entryRecorder_fingerprint(t *testing.T) {
+	viper.Set("execution.track.renames", true)
+	defer viper.Set("execution.track.renames", nil)
+
+	fetched := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched[strings.TrimSuffix(r.URL.Path, "/api/json")] = true
+		fmt.Fprint(w, `{"firstBuild":{"number":1,"timestamp":900}}`)
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+	item := func(path string) *ItemMetadata {
+		return &ItemMetadata{Path: path, URL: nameIdentifier(jenkins, path), Class: JobClassPipeline, Fingerprint: "1@100"}
+	}
+
+	tests := []struct {
+		name            string
+		base            string
+		wantFetched     bool
+		wantFingerprint string
+	}{
+		{
+			name:            "Selected",
+			base:            "/job/selected",
+			wantFetched:     true,
+			wantFingerprint: "1@900",
+		},
+		{
+			name:            "Recorded_Not_Selected",
+			base:            "/job/other",
+			wantFingerprint: "1@100",
+		},
+		{
+			// may have been renamed or moved there
+			name:            "New",
+			base:            "/job/new",
+			wantFetched:     true,
+			wantFingerprint: "1@900",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newEntryRecorder(discardSink{}, []*ItemMetadata{item("selected"), item("other")}, func(name string) bool { return name == "selected" })
+			pipeline := &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: tt.base}}
+			if err := recorder.send(context.Background(), []*pipelineJob{pipeline}); err != nil {
+				t.Fatal(err)
+			}
+			if fetched[tt.base] != tt.wantFetched {
+				t.Errorf("send() fetched the builds of %v = %v, want %v", tt.base, fetched[tt.base], tt.wantFetched)
+			}
+			if got := recorder.items[0].Fingerprint; got != tt.wantFingerprint {
+				t.Errorf("send() recorded fingerprint %v, want %v", got, tt.wantFingerprint)
+			}
+		})
+	}
+}
+
+func Test_entryRecorder_finish(t *testing.T) {
+	viper.Set("execution.track.renames", true)
+	defer viper.Set("execution.track.renames", nil)
+
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	items := []*ItemMetadata{
+		{Path: "team-a/deploy", URL: "https://jenkins/job/team-a/job/deploy/", Class: JobClassPipeline, Fingerprint: "1@100"},
+		{Path: "team-a/app/main", URL: "https://jenkins/job/team-a/job/app/job/main/", Class: JobClassPipeline, Fingerprint: "1@200"},
+	}
+	pipeline := func(base string, multiBranch string, fingerprint string) *pipelineJob {
+		return &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: base}, multiBranch: multiBranch, fingerprint: fingerprint, buildsKnown: true}
+	}
+	main := pipeline("/job/team-a/job/app/job/main", "team-a/app", "1@200")
+
+	tests := []struct {
+		name     string
+		live     []*pipelineJob
+		complete bool
+		want     map[string]string
+	}{
+		{
+			name: "Branch_Moved",
+			live: []*pipelineJob{pipeline("/job/team-b/job/app/job/main", "team-b/app", "1@200")},
+			want: map[string]string{"https://jenkins/job/team-b/job/app/job/main/": "https://jenkins/job/team-a/job/app/job/main/"},
+		},
+		{
+			name:     "Builds_Discarded_And_Moved",
+			live:     []*pipelineJob{main, pipeline("/job/team-b/job/deploy", "", "4@400")},
+			complete: true,
+			want: map[string]string{
+				"https://jenkins/job/team-a/job/app/job/main/": "",
+				"https://jenkins/job/team-b/job/deploy/":       "https://jenkins/job/team-a/job/deploy/",
+			},
+		},
+		{
+			// team-a/deploy may just not have been reached, team-b/deploy is then a pipeline left out of the selection
+			name: "Builds_Discarded_Partial_Discovery",
+			live: []*pipelineJob{main, pipeline("/job/team-b/job/deploy", "", "4@400")},
+			want: map[string]string{"https://jenkins/job/team-a/job/app/job/main/": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pipeline := range tt.live {
+				pipeline.previousIdentifier, pipeline.previousName = "", ""
+			}
+			stream := &fakeMasterStream{}
+			responses := newResponseStream(stream, nil, "test")
+			filter := &pipelineFilter{selected: []string{"team-a/deploy", "team-a/app"}}
+			responses.accept = filter.accepts
+			recorder := newEntryRecorder(responses, items, filter.accepts)
+
+			if err := recorder.send(context.Background(), tt.live); err != nil {
+				t.Fatal(err)
+			}
+			if err := recorder.finish(context.Background(), tt.complete); err != nil {
+				t.Fatalf("finish() error = %v", err)
+			}
+			if _, err := responses.finish(); err != nil {
+				t.Fatal(err)
+			}
+			// renamed pipelines are sent while selected under their previous name
+			got := map[string]string{}
+			for _, response := range stream.responses {
+				got[response.Asset.Identifier] = response.Asset.Attributes[AttrPreviousIdentifier]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent previous identifiers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"fmt"
+)
+
+// firstBuildFields are the fields of the first build of a job making up its fingerprint
+const firstBuildFields = "firstBuild[number,timestamp]"
+
+// lastBuildFields are the fields of the last build of a job reported in its attributes
+const lastBuildFields = "lastBuild[number,timestamp]"
+
+// buildRef is a build of a job. Builds move along with the job when it is renamed or moved, while
+// copying a job does not copy its builds, so the first build tells a job apart across scans. Jenkins
+// has no persistent job ID to prefer over it, but a build discarder deleting the first build changes
+// it, see rotatedFrom.
+type buildRef struct {
+	Number    int64 `json:"number"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// fingerprint returns the fingerprint of the job whose first build this is, jobs never built have none
+func (b *buildRef) fingerprint() string {
+	if b == nil || b.Timestamp == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d@%d", b.Number, b.Timestamp)
+}
+
+// parseFingerprint returns the number and timestamp of the first build a fingerprint was made of
+func parseFingerprint(fingerprint string) (int64, int64, bool) {
+	var number, timestamp int64
+	if _, err := fmt.Sscanf(fingerprint, "%d@%d", &number, &timestamp); err != nil {
+		return 0, 0, false
+	}
+	return number, timestamp, true
+}
+
+// rotatedFrom reports whether a pipeline with the current fingerprint may be the one recorded with the
+// previous fingerprint, its first builds having been discarded since. Build numbers are never reused,
+// so a job created since starts over at a lower number than a job whose builds rotated.
+func rotatedFrom(previous string, current string) bool {
+	previousNumber, previousTimestamp, ok := parseFingerprint(previous)
+	if !ok {
+		return false
+	}
+	number, timestamp, ok := parseFingerprint(current)
+	return ok && number > previousNumber && timestamp > previousTimestamp
+}
+
+// fetchBuilds completes a pipeline polled without its first and last builds, once
+func fetchBuilds(ctx context.Context, pipeline *pipelineJob) error {
+	if pipeline.buildsKnown {
+		return nil
+	}
+	var rsp struct {
+		FirstBuild *buildRef `json:"firstBuild"`
+		LastBuild  *buildRef `json:"lastBuild"`
+	}
+	query := map[string]string{
+		"tree": firstBuildFields + "," + lastBuildFields,
+	}
+	if err := getJSON(ctx, pipeline.Jenkins, pipeline.Base, &rsp, query); err != nil {
+		return err
+	}
+	pipeline.setBuilds(rsp.FirstBuild, rsp.LastBuild)
+	return nil
+}
+
+// setBuilds records the first and last builds of a pipeline, which are nil when it was never built
+func (p *pipelineJob) setBuilds(first *buildRef, last *buildRef) {
+	p.fingerprint = first.fingerprint()
+	if last != nil {
+		p.lastBuildAt = last.Timestamp
+	}
+	p.buildsKnown = true
+}
+
+// renamedFrom marks a pipeline as renamed or moved from the recorded item
+func (p *pipelineJob) renamedFrom(previous *ItemMetadata) {
+	p.previousIdentifier = previous.URL
+	if len(p.previousIdentifier) == 0 {
+		p.previousIdentifier = nameIdentifier(p.Jenkins, previous.Path)
+	}
+	p.previousName = previous.Path
+}
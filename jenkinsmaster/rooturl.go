@@ -0,0 +1,81 @@
+package jenkinsmaster
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/cloudbees-compliance/chlog-go/log"
+)
+
+// rootURLMapping maps item URLs built on the root URL configured in Jenkins to the account URL.
+// Both differ when Jenkins sits behind a reverse proxy, item URLs reported by Jenkins then point
+// at an internal host the plugin does not know about.
+type rootURLMapping struct {
+	accountURL string
+	// rootURL is empty when Jenkins reports no root URL or the same one as the account
+	rootURL string
+}
+
+// newRootURLMapping compares the account URL with the root URL Jenkins reports. Without a root URL
+// item URLs are assumed to be on the account URL already.
+func newRootURLMapping(accountURL string, rootURL string, requestId string) *rootURLMapping {
+	mapping := &rootURLMapping{accountURL: strings.TrimRight(accountURL, "/")}
+	if len(rootURL) == 0 {
+		return mapping
+	}
+	root, err := canonicalBaseURL(rootURL)
+	if err != nil {
+		log.Warn(requestId).Err(err).Msgf("Ignoring invalid Jenkins root URL %s", rootURL)
+		return mapping
+	}
+	if account, err := canonicalBaseURL(mapping.accountURL); err == nil && account == root {
+		return mapping
+	}
+	log.Info(requestId).Msgf("Jenkins root URL %s differs from the account URL %s, mapping item URLs to the account URL", root, mapping.accountURL)
+	mapping.rootURL = root
+	return mapping
+}
+
+// rootFromViewURL strips the view from a primary view URL, e.g. https://host/ctx/view/Dashboard/.
+// The primary view is usually the all view, whose URL is the root URL itself.
+func rootFromViewURL(viewURL string) string {
+	if idx := strings.Index(viewURL, "/view/"); idx >= 0 {
+		return viewURL[:idx+1]
+	}
+	return viewURL
+}
+
+// toAccountURL rewrites an item URL on the Jenkins root URL to the same item on the account URL.
+// Other URLs, including those already on the account URL, are returned unchanged.
+func (m *rootURLMapping) toAccountURL(itemURL string) string {
+	// the root URL may be a prefix of the account URL, e.g. when the proxy adds a context path
+	if _, ok := relativePath(m.accountURL, itemURL); ok {
+		return itemURL
+	}
+	path, ok := relativePath(m.rootURL, itemURL)
+	if !ok {
+		return itemURL
+	}
+	return m.accountURL + path
+}
+
+// relativePath returns the escaped path of itemURL below baseURL, ignoring scheme, host case and default ports
+func relativePath(baseURL string, itemURL string) (string, bool) {
+	if len(baseURL) == 0 {
+		return "", false
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", false
+	}
+	item, err := url.Parse(strings.TrimSpace(itemURL))
+	if err != nil || !isHTTPURL(item) || !sameHost(base, item) {
+		return "", false
+	}
+	basePath := strings.TrimRight(base.EscapedPath(), "/")
+	path := item.EscapedPath()
+	if path != basePath && !strings.HasPrefix(path, basePath+"/") {
+		return "", false
+	}
+	return path[len(basePath):], true
+}
@@ -0,0 +1,89 @@
+package jenkinsmaster
+
+import "testing"
+
+func Test_rootURLMapping_toAccountURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		accountURL string
+		rootURL    string
+		itemURL    string
+		want       string
+	}{
+		{
+			name:       "Internal_Host",
+			accountURL: "https://jenkins.example.com",
+			rootURL:    "http://jenkins-internal:8080",
+			itemURL:    "http://jenkins-internal:8080/job/team%20a/job/app/",
+			want:       "https://jenkins.example.com/job/team%20a/job/app/",
+		},
+		{
+			name:       "Context_Path_Added_By_Proxy",
+			accountURL: "https://proxy.example.com/jenkins",
+			rootURL:    "http://jenkins:8080",
+			itemURL:    "http://JENKINS:8080/job/app/",
+			want:       "https://proxy.example.com/jenkins/job/app/",
+		},
+		{
+			name:       "Context_Path_Removed_By_Proxy",
+			accountURL: "https://jenkins.example.com",
+			rootURL:    "https://jenkins.internal/ci",
+			itemURL:    "https://jenkins.internal/ci/job/app/",
+			want:       "https://jenkins.example.com/job/app/",
+		},
+		{
+			name:       "Root_Is_Prefix_Of_Account",
+			accountURL: "https://jenkins.example.com/ci",
+			rootURL:    "https://jenkins.example.com",
+			itemURL:    "https://jenkins.example.com/ci/job/app/",
+			want:       "https://jenkins.example.com/ci/job/app/",
+		},
+		{
+			name:       "Already_On_Account_URL",
+			accountURL: "https://jenkins.example.com",
+			rootURL:    "http://jenkins-internal:8080",
+			itemURL:    "https://jenkins.example.com/job/app/",
+			want:       "https://jenkins.example.com/job/app/",
+		},
+		{
+			name:       "No_Root_URL",
+			accountURL: "https://jenkins.example.com",
+			itemURL:    "http://jenkins-internal:8080/job/app/",
+			want:       "http://jenkins-internal:8080/job/app/",
+		},
+		{
+			name:       "Other_Context_Path",
+			accountURL: "https://jenkins.example.com",
+			rootURL:    "https://jenkins.internal/ci",
+			itemURL:    "https://jenkins.internal/cd/job/app/",
+			want:       "https://jenkins.internal/cd/job/app/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &rootURLMapping{accountURL: tt.accountURL, rootURL: tt.rootURL}
+			if got := m.toAccountURL(tt.itemURL); got != tt.want {
+				t.Errorf("toAccountURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rootFromViewURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		viewURL string
+		want    string
+	}{
+		{name: "All_View", viewURL: "https://jenkins.example.com/ci/", want: "https://jenkins.example.com/ci/"},
+		{name: "Other_View", viewURL: "https://jenkins.example.com/ci/view/Dashboard/", want: "https://jenkins.example.com/ci/"},
+		{name: "Empty", viewURL: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rootFromViewURL(tt.viewURL); got != tt.want {
+				t.Errorf("rootFromViewURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
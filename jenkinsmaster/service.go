@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bndr/gojenkins"
 	"github.com/cloudbees-compliance/chlog-go/log"
@@ -19,32 +23,137 @@ import (
 )
 
 const CredTypePassword = "password"
+const CredTypeBearer = "bearer"
+const CredTypeOAuth2 = "oauth2-client-credentials"
+const CredTypeAnonymous = "anonymous"
+
+const AssetTypePipeline = "PIPELINE"
+
+const DiscoveryModeTree = "tree"
+const DiscoveryModeWalk = "walk"
 
 const JobClassFolder = "Folder"
 const JobClassPipeline = "Pipeline"
+const JobClassMultiBranch = "MultiBranch"
+const JobClassOrganization = "Organization"
 const JobClassOther = "Other"
 
+const BranchKindBranch = "branch"
+const BranchKindChangeRequest = "change-request"
+const BranchKindTag = "tag"
+
+const AttrMultiBranchProject = "multiBranchProject"
+const AttrBranchKind = "branchKind"
+const AttrSCMOrganization = "scmOrganization"
+const AttrSCMRepository = "scmRepository"
+const AttrPreviousIdentifier = "previousIdentifier"
+
+// multibranch projects group their branch jobs into these views
+var branchKindViews = map[string]string{
+	"change-requests": BranchKindChangeRequest,
+	"tags":            BranchKindTag,
+}
+
 var ErrNoUsableCredentials = errors.New("no usable credentials found for account")
 
+// jenkinsCreds are the credentials of an account, which fields are used depends on the credential type:
+// userId and token for password, token for bearer and the client fields for OAuth2 client credentials
 type jenkinsCreds struct {
+	// Type is the type of the AccountCredential the credentials were read from
+	Type   string `json:"-"`
 	URL    string `json:"url"`
 	UserID string `json:"userId"`
 	Token  string `json:"token"`
+	// TokenURL is the OAuth2 token endpoint, auth.oauth2.token.url by default
+	TokenURL     string   `json:"tokenUrl"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+	// CACertificates, ClientCertificate and ClientKey are PEM encoded, see tlsConfig
+	CACertificates    string `json:"caCertificates"`
+	ClientCertificate string `json:"clientCertificate"`
+	ClientKey         string `json:"clientKey"`
+	ServerName        string `json:"serverName"`
+	// ProxyURL is the http, https or socks5 proxy Jenkins is reached through, see proxyFunc
+	ProxyURL      string   `json:"proxyUrl"`
+	ProxyUser     string   `json:"proxyUser"`
+	ProxyPassword string   `json:"proxyPassword"`
+	NoProxy       []string `json:"noProxy"`
+	// auth authorizes the requests of bearer and OAuth2 credentials
+	auth authorizer
+	// transport connects to Jenkins, the default transport when nil
+	transport http.RoundTripper
 }
 
+// AccountConfig lists the selected items by full name. An entry naming a
+// folder, organization folder or multibranch project selects every pipeline beneath it.
+// Views select the items they hold at execution time, nested views are named by their path.
+// Include patterns select further pipelines and exclude patterns drop pipelines however
+// they were selected, see pipelineFilter for the pattern syntax. Nodes select build agents
+// and the built-in node by name or pattern, see nodeFilter. Every node is selected when the
+// node key is absent and none when it is empty.
 type AccountConfig struct {
+	// Version is the metadata schema version, see MetadataVersion
+	Version   int      `json:"version"`
 	Pipelines []string `json:"pipeline,omitempty"`
+	Views     []string `json:"view,omitempty"`
+	Include   []string `json:"include,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+	// Nodes is written even when nil, so that an empty list selecting no node survives being written back
+	Nodes []string `json:"node"`
+	// Concurrency limits the number of concurrent Jenkins calls made while discovering pipelines
+	Concurrency int `json:"concurrency,omitempty"`
+	// Items describes every pipeline found on the controller at the last refresh, so that pipelines
+	// created since can be told apart from pipelines left out of the selection on purpose
+	Items []*ItemMetadata `json:"items,omitempty"`
+	// CredentialType is the type of the credentials the account was last validated with
+	CredentialType string `json:"credentialType,omitempty"`
+	// Diagnostics explains why the last validation failed, only set on failure
+	Diagnostics *AuthDiagnostics `json:"diagnostics,omitempty"`
+	// Refresh requests the pipelines to be reconciled with the controller on the next execution, it is
+	// cleared once they were, see execution.metadata.refresh
+	Refresh bool `json:"refresh,omitempty"`
+}
+
+// pipelineJob is a discovered pipeline along with the multibranch project
+// and organization folder it was created by, if any.
+type pipelineJob struct {
+	*gojenkins.Job
+	multiBranch     string
+	branchKind      string
+	organization    string
+	scmOrganization string
+	scmRepository   string
+	// fingerprint identifies the pipeline across renames and moves, see buildRef
+	fingerprint string
+	// lastBuildAt is the timestamp of the last build in milliseconds, 0 when never built
+	lastBuildAt int64
+	// buildsKnown is set once fingerprint and lastBuildAt are known, see fetchBuilds
+	buildsKnown bool
+	// previousIdentifier and previousName are the identifier and full name the pipeline had before it was
+	// renamed or moved
+	previousIdentifier string
+	previousName       string
 }
 
 type jenkinsMasterService struct {
 	service.CHPluginServiceServer
+	flavors *flavorCache
 }
 
 func NewJenkinsMasterService() plugin.CHPluginService {
-	return &jenkinsMasterService{}
+	return &jenkinsMasterService{flavors: newFlavorCache()}
 }
 
 func GetJobClass(Class string) string {
+	if strings.HasSuffix(Class, "MultiBranchProject") {
+		return JobClassMultiBranch
+	}
+
+	if strings.HasSuffix(Class, "OrganizationFolder") {
+		return JobClassOrganization
+	}
+
 	if strings.HasSuffix(Class, "Folder") {
 		return JobClassFolder
 	}
@@ -64,10 +173,18 @@ func (cs *jenkinsMasterService) GetManifest(context.Context, *service.GetManifes
 		Manifest: &domain.Manifest{
 			Uuid:    "524bf8d1-65bc-497c-8356-34fd63b96afd",
 			Name:    "JenkinsMaster",
-			Version: "0.0.2",
+			Version: "0.0.4",
 			AssetRoles: []*domain.AssetRole{
 				{
-					AssetType: "PIPELINE",
+					AssetType: AssetTypePipeline,
+					Role:      domain.Role_MASTER,
+				},
+				{
+					AssetType: AssetTypeController,
+					Role:      domain.Role_MASTER,
+				},
+				{
+					AssetType: AssetTypeNode,
 					Role:      domain.Role_MASTER,
 				},
 			},
@@ -83,7 +200,7 @@ func (cs *jenkinsMasterService) GetAssetDescriptors(context.Context, *service.Ge
 func (cs *jenkinsMasterService) parseAccount(ac *domain.Account) (*domain.AccountCredential, error) {
 	var foundCredentials *domain.AccountCredential
 	for _, cred := range ac.AccountCredential {
-		if cred.Type == CredTypePassword {
+		if supportedCredTypes[cred.Type] {
 			foundCredentials = cred
 			break
 		}
@@ -96,60 +213,90 @@ func (cs *jenkinsMasterService) parseAccount(ac *domain.Account) (*domain.Accoun
 	return foundCredentials, nil
 }
 
-func toMasterResponse(jobDetails *gojenkins.JobResponse) *domain.MasterResponse {
+// toMasterResponse describes a pipeline of a controller of the given flavor
+func toMasterResponse(pipeline *pipelineJob, flavor string) *domain.MasterResponse {
+	asset := &domain.MasterAsset{
+		Type:       AssetTypePipeline,
+		SubType:    flavor,
+		Identifier: pipeline.GetDetails().URL,
+		Attributes: itemAttributes(pipeline),
+	}
+	if identifier, err := jobIdentifier(pipeline.Job); err == nil {
+		asset.Identifier = identifier
+	}
+	if len(pipeline.multiBranch) > 0 {
+		asset.Attributes[AttrMultiBranchProject] = pipeline.multiBranch
+		asset.Attributes[AttrBranchKind] = pipeline.branchKind
+		if len(pipeline.organization) > 0 {
+			asset.Attributes[AttrSCMOrganization] = pipeline.scmOrganization
+			asset.Attributes[AttrSCMRepository] = pipeline.scmRepository
+		}
+	}
+	if len(pipeline.previousIdentifier) > 0 {
+		asset.Attributes[AttrPreviousIdentifier] = pipeline.previousIdentifier
+	}
 	return &domain.MasterResponse{
-		Asset: &domain.MasterAsset{
-			Type:       "PIPELINE",
-			SubType:    "cbci",
-			Identifier: jobDetails.URL,
-		},
+		Asset: asset,
+	}
+}
+
+// jobFullName returns the slash separated full name of a job, e.g. folder/pipeline
+func jobFullName(j *gojenkins.Job) string {
+	return strings.Join(jobPath(j), "/")
+}
+
+// jobPath returns the decoded names of the folders containing a job followed by its own name
+func jobPath(j *gojenkins.Job) []string {
+	names := strings.Split(strings.TrimPrefix(j.Base, "/job/"), "/job/")
+	for i, name := range names {
+		if decoded, err := url.PathUnescape(name); err == nil {
+			names[i] = decoded
+		}
 	}
+	return names
 }
 
+// ValidateAuthentication checks the credentials of an account by querying the controller and discovering
+// its pipelines. A failed check is classified, see AuthDiagnostics, and explained in the account metadata.
 func (cs *jenkinsMasterService) ValidateAuthentication(ctx context.Context, req *service.AuthCheckRequest) (*service.AuthCheckResult, error) {
 	var result = service.AuthResult_SUCCESS.Enum()
 	ac := req.Account
 	credData, err := cs.parseAccount(ac)
 	var acctMeta []byte
 	if err != nil {
-		result = service.AuthResult_CREDENTIALS_MISSING.Enum()
-	} else {
-		var creds jenkinsCreds
-		if err := json.Unmarshal([]byte(credData.Credentials), &creds); err != nil {
-			log.Error().Err(err).Msg("Unable to unmarshal credentials")
-			result = service.AuthResult_CREDENTIALS_MISSING.Enum()
-		} else {
-			client := GetHttpClient()
-			jenkins := gojenkins.CreateJenkins(&client, creds.URL, creds.UserID, creds.Token)
-			if _, err := jenkins.Init(ctx); err != nil {
-				log.Error().Err(err).Msgf("Authentication failed")
-				result = service.AuthResult_AUTHENTICATION_FAILURE.Enum()
-				return &service.AuthCheckResult{
-					Result: result,
-				}, nil
-			}
-			log.Debug().Msg("Jenkins Authentication passed")
-			var jobs []*gojenkins.Job
-			jobs, err = jenkins.GetAllJobs(ctx)
-			if err != nil {
-				log.Error().Err(err).Msg("Unable to get Jenkins jobs")
-				result = service.AuthResult_AUTHENTICATION_FAILURE.Enum()
-				return &service.AuthCheckResult{
-					Result:          result,
-					AccountMetadata: nil,
-				}, nil
-			}
-			log.Debug().Msgf("jenkins.GetAllJobs passed. %v jobs found", len(jobs))
-			acctMeta, err = cs.makeAccountMetadata(ctx, jobs)
-			if err != nil {
-				log.Error().Err(err).Msg("Error occurred while building Account Metadata")
-				result = service.AuthResult_AUTHENTICATION_FAILURE.Enum()
-				return &service.AuthCheckResult{
-					Result:          result,
-					AccountMetadata: nil,
-				}, nil
-			}
+		return diagnoseCredentials(err).result(ac.Metadata), nil
+	}
+	creds, err := readCredentials(credData)
+	if err != nil {
+		diagnostics := diagnoseCredentials(err)
+		diagnostics.CredentialType = credData.Type
+		return diagnostics.result(ac.Metadata), nil
+	}
+	defer creds.close()
+	ctx = withConcurrencyLimit(ctx, accountConcurrency(ac.Metadata))
+	jenkins := newJenkins(ctx, creds.URL, creds)
+	if _, err := jenkins.Init(ctx); err != nil {
+		return probeController(ctx, creds, err).of(creds).result(ac.Metadata), nil
+	}
+	if len(jenkins.Version) == 0 {
+		return diagnoseStatus(http.StatusOK, http.Header{}).of(creds).result(ac.Metadata), nil
+	}
+	log.Info().Str("credentialType", creds.Type).Msg("Jenkins Authentication passed")
+	var pipelines []*pipelineJob
+	pipelines, err = cs.discoverAllPipelines(ctx, jenkins)
+	if err != nil {
+		diagnostics := diagnoseError(err)
+		if diagnostics.Failure == FailureUnknown {
+			diagnostics = newAuthDiagnostics(FailureDiscovery, "The controller was queried but its pipelines could not be discovered.",
+				"Check that the credentials can read every folder, or narrow the selection down to readable ones.", err)
 		}
+		return diagnostics.of(creds).result(ac.Metadata), nil
+	}
+	log.Debug().Msgf("Discovery passed. %v pipelines found", len(pipelines))
+	acctMeta, err = cs.makeAccountMetadata(pipelines, creds.Type, ac.Metadata)
+	if err != nil {
+		diagnostics := newAuthDiagnostics(FailureUnknown, "The account metadata could not be built.", "Check the plugin logs.", err)
+		return diagnostics.of(creds).result(ac.Metadata), nil
 	}
 	return &service.AuthCheckResult{
 		Result:          result,
@@ -157,28 +304,283 @@ func (cs *jenkinsMasterService) ValidateAuthentication(ctx context.Context, req
 	}, nil
 }
 
-func (cs *jenkinsMasterService) getInnerJobs(ctx context.Context, j *gojenkins.Job) ([]*gojenkins.Job, error) {
-	var pipelines []*gojenkins.Job
-	nestedJobs, err := j.GetInnerJobs(ctx)
-	if err != nil {
+// discoverAllPipelines returns every pipeline on the controller
+func (cs *jenkinsMasterService) discoverAllPipelines(ctx context.Context, jenkins *gojenkins.Jenkins) ([]*pipelineJob, error) {
+	return cs.discoverTopLevelItems(ctx, jenkins, nil)
+}
+
+// discoverReadablePipelines discovers every pipeline on the controller, skipping the top level items that
+// fail to be discovered, e.g. folders the credentials cannot read. It returns why each skipped item failed
+// by full name, the discovery is only complete when there are none.
+func (cs *jenkinsMasterService) discoverReadablePipelines(ctx context.Context, jenkins *gojenkins.Jenkins, requestId string) (map[string]error, error) {
+	var mu sync.Mutex
+	skipped := map[string]error{}
+	_, err := cs.discoverTopLevelItems(ctx, jenkins, func(name string, err error) {
+		log.Warn(requestId).Err(err).Msgf("Skipping %s, which could not be discovered", name)
+		mu.Lock()
+		defer mu.Unlock()
+		skipped[name] = err
+	})
+	return skipped, err
+}
+
+// discoverTopLevelItems returns the pipelines among and beneath every top level item. Items failing to be
+// discovered are handed to skip when set instead of failing the discovery.
+func (cs *jenkinsMasterService) discoverTopLevelItems(ctx context.Context, jenkins *gojenkins.Jenkins, skip func(name string, err error)) ([]*pipelineJob, error) {
+	if viper.GetString("discovery.mode") == DiscoveryModeTree {
+		root, err := fetchItemTree(ctx, jenkins)
+		if err != nil {
+			return nil, err
+		}
+		return newTreeWalker(cs, jenkins).rootPipelines(ctx, root.Jobs, skip)
+	}
+
+	var root struct {
+		Jobs []gojenkins.InnerJob `json:"jobs"`
+	}
+	if err := getJSON(ctx, jenkins, "/", &root, map[string]string{"tree": "jobs[name,url]"}); err != nil {
 		return nil, err
 	}
+	innerJobs := root.Jobs
+	log.Debug().Msgf("Top level jobs listed. %v jobs found", len(innerJobs))
+	return collect(ctx, len(innerJobs), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		var pipelines []*pipelineJob
+		job, err := fetchJob(ctx, jenkins, itemBase(innerJobs[i].Name))
+		if err == nil {
+			pipelines, err = cs.expandJobs(ctx, []*gojenkins.Job{job})
+		}
+		if err != nil && skip != nil && ctx.Err() == nil {
+			skip(innerJobs[i].Name, err)
+			err = nil
+		}
+		return emit(ctx, pipelines, err)
+	})
+}
+
+// discoverSkippedPipelines discovers the selected items lying within top level items a full discovery
+// skipped, one by one, so that items outside the selection never fail the selected pipelines. Skipped
+// items are reported as failed assets themselves when every pipeline is selected. The other selected
+// items selecting none of the pipelines recorded by discovered are reported as not found.
+func (cs *jenkinsMasterService) discoverSkippedPipelines(ctx context.Context, jenkins *gojenkins.Jenkins, filter *pipelineFilter, skipped map[string]error, discovered *entryRecorder, requestId string) error {
+	if filter.all {
+		var skippedNames []string
+		for name := range skipped {
+			skippedNames = append(skippedNames, name)
+		}
+		sort.Strings(skippedNames)
+		for _, name := range skippedNames {
+			if filter.isExcluded(name) {
+				continue
+			}
+			if err := reportFailure(ctx, nameIdentifier(jenkins, name), skipped[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-	for _, nestedJob := range nestedJobs {
-		job := nestedJob
+	var names []string
+	for _, selected := range filter.discoveryNames() {
+		if _, ok := skipped[strings.SplitN(selected, "/", 2)[0]]; ok {
+			names = append(names, selected)
+		}
+	}
+	for _, selected := range filter.selected {
+		if _, ok := skipped[strings.SplitN(selected, "/", 2)[0]]; ok || discovered == nil || discovered.selectsAny(selected) {
+			continue
+		}
+		err := &statusError{URL: jenkins.Server + itemBase(strings.Split(selected, "/")...), StatusCode: http.StatusNotFound}
+		if err := reportFailure(ctx, nameIdentifier(jenkins, selected), err); err != nil {
+			return err
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := cs.discoverPipelines(ctx, jenkins, names, requestId)
+	return err
+}
+
+// discoverPipelines returns the pipelines selected by full name. Names that no longer exist or fail
+// to be discovered are skipped and reported as failed assets.
+func (cs *jenkinsMasterService) discoverPipelines(ctx context.Context, jenkins *gojenkins.Jenkins, names []string, requestId string) ([]*pipelineJob, error) {
+	if viper.GetString("discovery.mode") == DiscoveryModeTree {
+		root, err := fetchItemTree(ctx, jenkins)
+		if err != nil {
+			return nil, err
+		}
+		return newTreeWalker(cs, jenkins).selectPipelines(ctx, root, names, requestId)
+	}
+
+	return collect(ctx, len(names), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		log.Debug(requestId).Msg(fmt.Sprintf("Selected Job: %v\n", names[i]))
+		job, err := fetchJob(ctx, jenkins, itemBase(strings.Split(names[i], "/")...))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			log.Error(requestId).Err(err).Msgf("Unable to find Jenkins job for %s", names[i])
+			return nil, reportFailure(ctx, nameIdentifier(jenkins, names[i]), err)
+		}
+		pipelines, err := cs.expandJobs(ctx, []*gojenkins.Job{job})
+		pipelines, err = emit(ctx, pipelines, err)
+		if err != nil && ctx.Err() == nil {
+			// the other selected items are still discovered
+			log.Error(requestId).Err(err).Msgf("Unable to discover pipelines of %s", names[i])
+			return pipelines, reportFailure(ctx, nameIdentifier(jenkins, names[i]), err)
+		}
+		return pipelines, err
+	})
+}
+
+// expandJobs returns the given pipelines along with every pipeline beneath the given folders
+func (cs *jenkinsMasterService) expandJobs(ctx context.Context, jobs []*gojenkins.Job) ([]*pipelineJob, error) {
+	return collect(ctx, len(jobs), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		job := jobs[i]
 		switch GetJobClass(job.Raw.Class) {
 		case JobClassFolder:
-			if nextLevel, err := cs.getInnerJobs(ctx, job); err != nil {
-				return nil, err
-			} else {
-				pipelines = append(pipelines, nextLevel...)
+			nestedJobs, err := cs.getInnerJobs(ctx, job)
+			if err != nil {
+				err = fmt.Errorf("unable to get nested jobs of %s: %w", job.Base, err)
+			}
+			return nestedJobs, err
+		case JobClassOrganization:
+			orgJobs, err := cs.getOrganizationJobs(ctx, job)
+			if err != nil {
+				err = fmt.Errorf("unable to get organization folder jobs of %s: %w", job.Base, err)
+			}
+			return orgJobs, err
+		case JobClassMultiBranch:
+			branchJobs, err := cs.getBranchJobs(ctx, job)
+			if err == nil {
+				err = cs.setOrganization(ctx, job, branchJobs)
 			}
+			if err != nil {
+				err = fmt.Errorf("unable to get multibranch jobs of %s: %w", job.Base, err)
+			}
+			return branchJobs, err
 		case JobClassPipeline:
-			pipelines = append(pipelines, job)
+			pipeline, err := cs.toPipelineJob(ctx, job)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get parent of job %s: %w", job.Base, err)
+			}
+			return []*pipelineJob{pipeline}, nil
 		}
+		return nil, nil
+	})
+}
+
+func (cs *jenkinsMasterService) getInnerJobs(ctx context.Context, j *gojenkins.Job) ([]*pipelineJob, error) {
+	innerJobs := j.Raw.Jobs
+	return collect(ctx, len(innerJobs), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		job, err := fetchInnerJob(ctx, j, innerJobs[i].Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch GetJobClass(job.Raw.Class) {
+		case JobClassFolder:
+			return cs.getInnerJobs(ctx, job)
+		case JobClassOrganization:
+			return cs.getOrganizationJobs(ctx, job)
+		case JobClassMultiBranch:
+			return cs.getBranchJobs(ctx, job)
+		case JobClassPipeline:
+			return []*pipelineJob{{Job: job}}, nil
+		}
+		return nil, nil
+	})
+}
+
+// getBranchJobs returns the branch, change request and tag pipelines of a multibranch project
+func (cs *jenkinsMasterService) getBranchJobs(ctx context.Context, mb *gojenkins.Job) ([]*pipelineJob, error) {
+	kinds, err := getBranchKinds(ctx, mb)
+	if err != nil {
+		return nil, err
 	}
 
-	return pipelines, nil
+	mbName := jobFullName(mb)
+	branchJobs := mb.Raw.Jobs
+	return collect(ctx, len(branchJobs), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+		branchJob, err := fetchInnerJob(ctx, mb, branchJobs[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		if GetJobClass(branchJob.Raw.Class) != JobClassPipeline {
+			return nil, nil
+		}
+		return []*pipelineJob{{
+			Job:         branchJob,
+			multiBranch: mbName,
+			branchKind:  branchKind(kinds, branchJob.GetName()),
+		}}, nil
+	})
+}
+
+// getBranchKinds maps the names of change request and tag jobs of a multibranch project to their kind.
+// Jobs not in the map are plain branches.
+func getBranchKinds(ctx context.Context, mb *gojenkins.Job) (map[string]string, error) {
+	kinds := map[string]string{}
+	for viewName, kind := range branchKindViews {
+		view := new(gojenkins.ViewResponse)
+		var rsp *http.Response
+		err := withSlot(ctx, func() (err error) {
+			rsp, err = mb.Jenkins.Requester.GetJSON(ctx, mb.Base+"/view/"+viewName, view, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		// the view only exists when the SCM source discovers that kind of head
+		if rsp.StatusCode != http.StatusOK {
+			continue
+		}
+		for _, job := range view.Jobs {
+			kinds[job.Name] = kind
+		}
+	}
+
+	return kinds, nil
+}
+
+func branchKind(kinds map[string]string, name string) string {
+	if kind, ok := kinds[name]; ok {
+		return kind
+	}
+	return BranchKindBranch
+}
+
+// getParentJob returns the folder containing a job, or nil for top level jobs
+func getParentJob(ctx context.Context, job *gojenkins.Job) (*gojenkins.Job, error) {
+	idx := strings.LastIndex(job.Base, "/job/")
+	if idx <= 0 {
+		return nil, nil
+	}
+
+	return fetchJob(ctx, job.Jenkins, job.Base[:idx])
+}
+
+// toPipelineJob wraps a directly selected pipeline, recording its multibranch project if it is a branch job
+func (cs *jenkinsMasterService) toPipelineJob(ctx context.Context, job *gojenkins.Job) (*pipelineJob, error) {
+	pipeline := &pipelineJob{Job: job}
+	parent, err := getParentJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil || GetJobClass(parent.Raw.Class) != JobClassMultiBranch {
+		return pipeline, nil
+	}
+
+	kinds, err := getBranchKinds(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	pipeline.multiBranch = jobFullName(parent)
+	pipeline.branchKind = branchKind(kinds, job.GetName())
+	if err := cs.setOrganization(ctx, parent, []*pipelineJob{pipeline}); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
 }
 
 func (cs *jenkinsMasterService) ExecuteMaster(ctx context.Context, req *service.ExecuteRequest, stream service.CHPluginService_MasterServer) ([]*domain.MasterResponse, error) {
@@ -193,20 +595,21 @@ func (cs *jenkinsMasterService) ExecuteMaster(ctx context.Context, req *service.
 	defer log.DestroySubLogger(requestId)
 
 	log.Debug(requestId).Msg("Jenkins master execution started")
+	ctx = withConcurrencyLimit(ctx, accountConcurrency(req.Account.Metadata))
 
 	ac := req.Account
 	credData, err := cs.parseAccount(ac)
 	if err != nil {
 		return nil, errors.New("failed to parse account details in ExecuteRequest")
 	}
-	var creds jenkinsCreds
-	if err := json.Unmarshal([]byte(credData.Credentials), &creds); err != nil {
-		log.Error(requestId).Err(err).Msg("Unable to unmarshal credentials")
+	creds, err := readCredentials(credData)
+	if err != nil {
+		log.Error(requestId).Err(err).Str("credentialType", credData.Type).Msg("Unable to read credentials")
 		return nil, err
 	}
-	log.Debug(requestId).Msg("gojenkins.CreateJenkins step start")
-	client := GetHttpClient()
-	jenkins := gojenkins.CreateJenkins(&client, creds.URL, creds.UserID, creds.Token)
+	defer creds.close()
+	log.Debug(requestId).Msgf("gojenkins.CreateJenkins step start with %s credentials", creds.Type)
+	jenkins := newJenkins(ctx, creds.URL, creds)
 	log.Debug(requestId).Msg("gojenkins.CreateJenkins step end")
 
 	if _, err := jenkins.Init(ctx); err != nil {
@@ -214,71 +617,215 @@ func (cs *jenkinsMasterService) ExecuteMaster(ctx context.Context, req *service.
 		return nil, err
 	}
 	log.Debug(requestId).Msg("jenkins.Init passed")
+	controller, err := cs.describeController(ctx, ac.Uuid, jenkins, requestId)
+	if err != nil {
+		log.Warn(requestId).Err(err).Msg("Unable to get the Jenkins root URL")
+	}
+
+	// pipelines are sent on the stream as discovery roots complete rather than returned at the end
+	responses := newResponseStream(stream, nil, requestId)
+	var managed []*managedController
+	if controller.flavor == FlavorCBCIOC && viper.GetBool("execution.opscenter.fanout") {
+		managed, err = listManagedControllers(ctx, jenkins)
+		if err != nil && ctx.Err() == nil {
+			log.Warn(requestId).Err(err).Msg("Unable to list the controllers managed by the operations center")
+		}
+	}
+	assetIdentifiers := assignIdentifiers(req.AssetIdentifiers, managed)
+	if len(req.AssetIdentifiers) == 0 || len(assetIdentifiers) > 0 {
+		// the pipelines saved in the account metadata may live on any managed controller
+		refresh := len(managed) == 0
+		urls := newRootURLMapping(jenkins.Server, controller.rootURL, requestId)
+		err := cs.executeController(ctx, jenkins, controller, req.Account.Metadata, assetIdentifiers, responses.forController(urls, jenkins.Server, controller.flavor), refresh, requestId)
+		if err != nil {
+			masterResponses, _ := responses.finish()
+			return masterResponses, err
+		}
+	}
+	if err := cs.executeManagedControllers(ctx, creds, managed, req, responses, requestId); err != nil {
+		masterResponses, _ := responses.finish()
+		return masterResponses, err
+	}
 
-	var jobs []*gojenkins.Job
-	if len(req.AssetIdentifiers) == 0 {
-		//jobs, err = jenkins.GetAllJobs(ctx)
+	masterResponses, err := responses.finish()
+	if err != nil {
+		return masterResponses, err
+	}
+	if err := ctx.Err(); err != nil {
+		log.Warn(requestId).Err(err).Msgf("Discovery interrupted, returning %v pipelines found so far", responses.count())
+		return masterResponses, fmt.Errorf("%w: %v", ErrPartialDiscovery, err)
+	}
+
+	log.Debug(requestId).Msgf("Length of response to CE %v", responses.count())
+	return masterResponses, nil
+}
+
+// executeController discovers the assets of a single controller: the assets requested by identifier, or
+// when there are none the assets selected by the account metadata. The account metadata is only refreshed
+// when refresh is set, as a single account configuration cannot track the items of several controllers.
+func (cs *jenkinsMasterService) executeController(ctx context.Context, jenkins *gojenkins.Jenkins, controller *controllerInfo, metadata []byte, identifiers []string, responses *responseStream, refresh bool, requestId string) error {
+	if len(identifiers) == 0 {
 		log.Debug(requestId).Msg("Empty Asset Identifiers")
-		var pMeta *AccountConfig
-		var pipelines []string
-		var job *gojenkins.Job
-		if req.Account.Metadata == nil {
+		if metadata == nil {
 			log.Error(requestId).Msg("Account Metadata is missing in the request")
-			return nil, errors.New("error occurred while executing Jenkins Master")
+			return errors.New("error occurred while executing Jenkins Master")
 		}
-		err = json.Unmarshal(req.Account.Metadata, &pMeta)
+		pMeta, err := parseAccountConfig(metadata)
 		if err != nil {
 			log.Error(requestId).Err(err).Msg("Unable to unmarshal Jenkins jobs from Account Metadata")
-			return nil, errors.New("error occurred while executing Jenkins Master")
+			return errors.New("error occurred while executing Jenkins Master")
 		}
 		log.Debug(requestId).Msg(fmt.Sprintf("Account Metadata: %v\n", pMeta))
-		pipelines = parsePipelineMap(pMeta)
-		if len(pipelines) > 0 {
-			for _, value := range pipelines {
-				parentIds := []string{}
-				log.Debug(requestId).Msg(fmt.Sprintf("Selected Job: %v\n", value))
-				tokens := strings.Split(value, "/")
-				if len(tokens) > 0 {
-					parentIds = tokens[:len(tokens)-1]
-				}
-				job, err = jenkins.GetJob(ctx, tokens[len(tokens)-1], parentIds...)
-				if err != nil {
-					log.Error(requestId).Err(err).Msgf("Unable to find Jenkins job for %s", value)
-					continue
+		filter, err := newPipelineFilter(pMeta)
+		if err != nil {
+			log.Error(requestId).Err(err).Msg("Invalid pipeline filter in Account Metadata")
+			return err
+		}
+		if pMeta != nil && len(pMeta.Views) > 0 {
+			viewJobs, err := getViewJobNames(ctx, jenkins, pMeta.Views, responses, requestId)
+			if err != nil && ctx.Err() == nil {
+				log.Error(requestId).Err(err).Msg("Unable to get Jenkins views")
+				return err
+			}
+			filter.selected = append(filter.selected, viewJobs...)
+		}
+		responses.accept = filter.accepts
+		if err := responses.sendController(jenkins.Server, controller); err != nil {
+			return err
+		}
+		nodes, err := newNodeFilter(pMeta)
+		if err != nil {
+			log.Error(requestId).Err(err).Msg("Invalid node filter in Account Metadata")
+			return err
+		}
+		if nodes.any() {
+			if err := discoverNodes(ctx, jenkins, nodes, responses, requestId); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+		// reconciling the saved pipelines with the controller takes discovering all of them
+		var recorder *entryRecorder
+		var sink pipelineSink = responses
+		if refresh && pMeta != nil && (pMeta.Refresh || viper.GetBool("execution.metadata.refresh")) && len(pMeta.Pipelines) > 0 {
+			recorder = newEntryRecorder(responses, pMeta.Items, filter.accepts)
+			sink = recorder
+		}
+		ctx := withPipelineSink(ctx, sink)
+		complete := false
+		if filter.all || recorder != nil {
+			var skipped map[string]error
+			skipped, err = cs.discoverReadablePipelines(ctx, jenkins, requestId)
+			complete = err == nil && len(skipped) == 0 && ctx.Err() == nil
+			if err == nil && len(skipped) > 0 {
+				// reconciling with a partial discovery would remove every pipeline that was skipped
+				if recorder != nil {
+					log.Warn(requestId).Msgf("Not refreshing Account Metadata, %v items could not be discovered", len(skipped))
 				}
-				jobs = append(jobs, job)
+				err = cs.discoverSkippedPipelines(ctx, jenkins, filter, skipped, recorder, requestId)
+			}
+		} else {
+			_, err = cs.discoverPipelines(ctx, jenkins, filter.discoveryNames(), requestId)
+		}
+		if recorder != nil && ctx.Err() == nil {
+			if err := recorder.finish(ctx, complete); err != nil {
+				return err
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Error(requestId).Err(err).Msgf("Unable to get Jenkins jobs, %v pipelines found before the failure", responses.count())
+			return err
+		}
+		// a partial discovery would have every pipeline not reached yet removed
+		if recorder != nil && complete {
+			if err := cs.refreshAccountMetadata(ctx, jenkins, recorder, pMeta, filter, responses, requestId); err != nil {
+				log.Error(requestId).Err(err).Msg("Unable to refresh Account Metadata")
+				return err
 			}
 		}
-		log.Debug(requestId).Msgf("jenkins.GetJobs from metadata passed. %v jobs found", len(jobs))
 	} else {
-		jobs, err = cs.getSelectedJobs(ctx, jenkins, req.AssetIdentifiers, *log.GetLogger(requestId))
-		if err != nil {
+		// identifiers may have been taken from URLs reported by Jenkins
+		var assetIdentifiers, nodeNames []string
+		for _, identifier := range identifiers {
+			identifier = responses.urls.toAccountURL(identifier)
+			if isControllerIdentifier(jenkins.Server, identifier) {
+				if err := responses.sendController(jenkins.Server, controller); err != nil {
+					return err
+				}
+				continue
+			}
+			if name, ok := nodeNameFromIdentifier(jenkins.Server, identifier); ok {
+				nodeNames = append(nodeNames, name)
+				continue
+			}
+			assetIdentifiers = append(assetIdentifiers, identifier)
+		}
+		if err := sendSelectedNodes(ctx, jenkins, nodeNames, responses, requestId); err != nil && ctx.Err() == nil {
+			return err
+		}
+		// exclusions apply to assets requested by identifier too
+		if pMeta, err := parseAccountConfig(metadata); err == nil {
+			if filter, err := newPipelineFilter(pMeta); err == nil {
+				responses.accept = func(name string) bool { return !filter.isExcluded(name) }
+			}
+		}
+		ctx := withPipelineSink(ctx, responses)
+		jobs, err := cs.getSelectedJobs(ctx, jenkins, assetIdentifiers, *log.GetLogger(requestId))
+		if err != nil && ctx.Err() == nil {
 			log.Error(requestId).Err(err).Msg("Unable to get Jenkins jobs")
-			return nil, err
+			return err
 		}
 		log.Debug(requestId).Msgf("jenkins.GetSelectedJobs passed. %v jobs found", len(jobs))
+		_, err = collect(ctx, len(jobs), func(ctx context.Context, i int) ([]*pipelineJob, error) {
+			pipelines, err := cs.expandJobs(ctx, jobs[i:i+1])
+			pipelines, err = emit(ctx, pipelines, err)
+			if err != nil && ctx.Err() == nil {
+				log.Error(requestId).Err(err).Msgf("Unable to get nested jobs of %s", jobs[i].Base)
+				identifier, idErr := jobIdentifier(jobs[i])
+				if idErr != nil {
+					return pipelines, err
+				}
+				return pipelines, reportFailure(ctx, identifier, err)
+			}
+			return pipelines, err
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Error(requestId).Err(err).Msgf("Unable to get nested jobs, %v pipelines found before the failure", responses.count())
+			return err
+		}
 	}
 
-	var masterResponses []*domain.MasterResponse
+	return nil
+}
 
-	for _, job := range jobs {
-		switch GetJobClass(job.Raw.Class) {
-		case JobClassFolder:
-			if nestedJobs, err := cs.getInnerJobs(ctx, job); err != nil {
-				log.Error(requestId).Err(err).Msg("Unable to get nested jobs")
-				return nil, err
-			} else {
-				for _, nestedJob := range nestedJobs {
-					masterResponses = append(masterResponses, toMasterResponse(nestedJob.GetDetails()))
-				}
-			}
-		case JobClassPipeline:
-			masterResponses = append(masterResponses, toMasterResponse(job.GetDetails()))
+// refreshAccountMetadata reconciles the saved account configuration with the pipelines discovered and sends
+// the refreshed metadata when it changed. Removed entries are reported as assets that were not found.
+func (cs *jenkinsMasterService) refreshAccountMetadata(ctx context.Context, jenkins *gojenkins.Jenkins, recorder *entryRecorder, pMeta *AccountConfig, filter *pipelineFilter, responses *responseStream, requestId string) error {
+	refresh := recorder.refreshAccountConfig(pMeta, filter, time.Now())
+	for _, entry := range refresh.removed {
+		err := &statusError{URL: jenkins.Server + itemBase(strings.Split(entry, "/")...), StatusCode: http.StatusNotFound}
+		if err := reportFailure(ctx, nameIdentifier(jenkins, entry), err); err != nil {
+			return err
 		}
 	}
+	if !refresh.changed() {
+		log.Debug(requestId).Msg("Account Metadata is up to date")
+		return nil
+	}
+	log.Info(requestId).Msgf("Refreshing Account Metadata, pipelines added: %v, removed: %v, renamed or moved: %v", refresh.added, refresh.removed, refresh.renamed)
+	metadata, err := encodeAccountConfig(&refresh.config, requestId)
+	if err != nil {
+		return err
+	}
+	return responses.sendMetadata(metadata)
+}
 
-	log.Debug(requestId).Msgf("Length of response to CE %v", len(masterResponses))
-	return masterResponses, nil
+// accountConcurrency returns the discovery concurrency limit configured in the account metadata,
+// or the service default when there is none
+func accountConcurrency(metadata []byte) int {
+	if pMeta, err := parseAccountConfig(metadata); err == nil && pMeta != nil && pMeta.Concurrency > 0 {
+		return pMeta.Concurrency
+	}
+	return viper.GetInt("discovery.concurrency")
 }
 
 func createLogger(req *service.ExecuteRequest, ctx context.Context) (contxt context.Context) {
@@ -304,6 +851,9 @@ func createLogger(req *service.ExecuteRequest, ctx context.Context) (contxt cont
 	return ctx
 
 }
+
+// getSelectedJobs returns the jobs of the requested asset identifiers. Identifiers that are invalid or whose
+// job cannot be fetched are reported as failed assets rather than failing the whole execution.
 func (cs *jenkinsMasterService) getSelectedJobs(ctx context.Context, jenkins *gojenkins.Jenkins, assetIdentifiers []string, logger zerolog.Logger) ([]*gojenkins.Job, error) {
 	var selectedJobs []*gojenkins.Job
 	baseURL := jenkins.Server
@@ -314,18 +864,39 @@ func (cs *jenkinsMasterService) getSelectedJobs(ctx context.Context, jenkins *go
 	}
 	baseURL = strings.TrimSuffix(baseURL, "/")
 
+	requested := map[string]bool{}
 	for _, jobUrl := range assetIdentifiers {
 
 		jobId, parentIds, err := extractJobDetails(baseURL, jobUrl, logger)
 		if err != nil {
-			return nil, err
+			if err := reportFailure(ctx, jobUrl, err); err != nil {
+				return selectedJobs, err
+			}
+			continue
 		}
-		if len(jobId) == 0 {
-			return nil, errors.New(fmt.Sprintf("Not valid jenkins name found for asset = %s", jobUrl))
+		identifier, err := canonicalItemURL(baseURL, &ItemPath{Folders: parentIds, Name: jobId})
+		if err != nil {
+			logger.Error().Err(err).Msgf("Unable to build the identifier of asset = %s", jobUrl)
+			if err := reportFailure(ctx, jobUrl, err); err != nil {
+				return selectedJobs, err
+			}
+			continue
 		}
-		jenkinsJob, err := jenkins.GetJob(ctx, jobId, parentIds...)
+		if requested[identifier] {
+			logger.Debug().Msgf("Skipping duplicate asset = %s", jobUrl)
+			continue
+		}
+		requested[identifier] = true
+		jenkinsJob, err := fetchJob(ctx, jenkins, itemBase(append(parentIds, jobId)...))
 		if err != nil {
-			return nil, err
+			if ctx.Err() != nil {
+				return selectedJobs, err
+			}
+			logger.Error().Err(err).Msgf("Unable to get Jenkins job for asset = %s", jobUrl)
+			if err := reportFailure(ctx, identifier, err); err != nil {
+				return selectedJobs, err
+			}
+			continue
 		}
 		selectedJobs = append(selectedJobs, jenkinsJob)
 	}
@@ -334,38 +905,16 @@ func (cs *jenkinsMasterService) getSelectedJobs(ctx context.Context, jenkins *go
 }
 
 func extractJobDetails(baseURL string, pipeLineURL string, logger zerolog.Logger) (string, []string, error) {
-	var parentJobIds []string
-	jobId := ""
-
-	if len(pipeLineURL) == 0 || !strings.Contains(pipeLineURL, "/") {
-		logger.Error().Msgf("asset Identifier is empty or Invalid %s", pipeLineURL)
-		return jobId, parentJobIds, errors.New("asset Identifier is empty or Invalid ")
-	}
-	_, err := url.ParseRequestURI(pipeLineURL)
-	if err != nil {
-		logger.Error().Msgf("Not able to parse pipeline URL from asset Id = %s is not valid", pipeLineURL)
-		return jobId, parentJobIds, err
-	}
-
 	logger.Trace().Msgf("Formed Base URL : %s", baseURL)
 	logger.Trace().Msgf("Original Asset URL : %s", pipeLineURL)
-	// Remove the base from full url
-	result := strings.Split(pipeLineURL, baseURL)
-	filteredPath := result[len(result)-1]
-	paths := strings.Split(filteredPath, "/")
-
-	for _, splitPath := range paths {
-		if len(splitPath) != 0 && splitPath != "job" {
-			jobId = splitPath
-			parentJobIds = append(parentJobIds, splitPath)
-		}
-	}
-	if len(parentJobIds) > 0 {
-		parentJobIds = parentJobIds[:len(parentJobIds)-1]
+	itemPath, err := ParseItemURL(baseURL, pipeLineURL)
+	if err != nil {
+		logger.Error().Err(err).Msgf("asset Identifier is empty or Invalid %s", pipeLineURL)
+		return "", nil, err
 	}
 
-	logger.Debug().Msgf("Job Id = %v , Parent Ids = %v for asset = %v", jobId, len(parentJobIds), pipeLineURL)
-	return jobId, parentJobIds, nil
+	logger.Debug().Msgf("Job Id = %v , Parent Ids = %v for asset = %v", itemPath.Name, len(itemPath.Folders), pipeLineURL)
+	return itemPath.Name, itemPath.Folders, nil
 }
 
 // Empty function definitions required to satisfy the CHPluginServiceServer interface
@@ -385,31 +934,49 @@ func (cs *jenkinsMasterService) ExecuteAssessor(context.Context, *service.Execut
 	return nil, errors.New("Does not  support this role")
 }
 
-func (cs *jenkinsMasterService) makeAccountMetadata(ctx context.Context, jobs []*gojenkins.Job) ([]byte, error) {
-	var pipelineList []string
-	for _, job := range jobs {
-		switch GetJobClass(job.Raw.Class) {
-		case JobClassFolder:
-
-			if nestedJobs, err := cs.getInnerJobs(ctx, job); err != nil {
-				log.Error().Err(err).Msg("Unable to get nested jobs")
-				return nil, err
-			} else {
-				for _, nestedJob := range nestedJobs {
-					jobName := strings.ReplaceAll(nestedJob.Base, "/job/", "/")
-					pipelineList = append(pipelineList, jobName[1:])
-				}
-			}
-		case JobClassPipeline:
-			pipelineList = append(pipelineList, job.GetName())
+// makeAccountMetadata selects every pipeline found, recording the type of the credentials they were found with.
+// The views, patterns, nodes and concurrency of the saved metadata only exist there and are kept as is.
+func (cs *jenkinsMasterService) makeAccountMetadata(pipelines []*pipelineJob, credType string, saved []byte) ([]byte, error) {
+	config := &AccountConfig{
+		Version:        MetadataVersion,
+		CredentialType: credType,
+	}
+	var savedItems []*ItemMetadata
+	if len(saved) > 0 {
+		if previous, err := parseAccountConfig(saved); err != nil {
+			log.Warn().Err(err).Msg("Unable to read the saved Account Metadata, its settings are not kept")
+		} else if previous != nil {
+			config.Views = previous.Views
+			config.Include = previous.Include
+			config.Exclude = previous.Exclude
+			config.Nodes = previous.Nodes
+			config.Concurrency = previous.Concurrency
+			savedItems = previous.Items
+		}
+	}
 
+	var pipelineList []string
+	var items []*ItemMetadata
+	selected := map[string]bool{}
+	seen := map[string]bool{}
+	for _, pipeline := range pipelines {
+		if name := selectionName(pipeline); !selected[name] {
+			selected[name] = true
+			pipelineList = append(pipelineList, name)
+		}
+		item := metadataItem(pipeline)
+		if !seen[item.Path] {
+			seen[item.Path] = true
+			items = append(items, item)
 		}
 	}
+	// items found before keep when they were first discovered
+	stampItems(items, savedItems, time.Now())
 
-	jobMap := map[string][]string{}
-	jobMap["pipeline"] = pipelineList
 	log.Debug().Msg(fmt.Sprintf("Fetched Number of jobs: %v\n", len(pipelineList)))
-	return json.Marshal(jobMap)
+	config.Pipelines = pipelineList
+	config.Items = items
+	return encodeAccountConfig(config)
 }
 
 func parsePipelineMap(pMap *AccountConfig) []string {
@@ -1,11 +1,18 @@
 package jenkinsmaster
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bndr/gojenkins"
 	"github.com/cloudbees-compliance/chlog-go/log"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_extractJobDetails1(t *testing.T) {
@@ -63,6 +70,39 @@ func Test_extractJobDetails1(t *testing.T) {
 			want1:   []string{"BuildJobs"},
 			wantErr: false,
 		},
+		{
+			name: "PipeLine_URL_view",
+			args: args{
+				baseURL:     "https://gauntlet-3.cloudbees.com/compliance-hub",
+				pipeLineURL: "https://gauntlet-3.cloudbees.com/compliance-hub/view/Builds/job/BuildJobs/job/compliance-hub-compliance-engine/",
+				logger:      *logger,
+			},
+			want:    "compliance-hub-compliance-engine",
+			want1:   []string{"BuildJobs"},
+			wantErr: false,
+		},
+		{
+			name: "PipeLine_URL_nested_view",
+			args: args{
+				baseURL:     "https://gauntlet-3.cloudbees.com",
+				pipeLineURL: "https://gauntlet-3.cloudbees.com/view/Teams/view/Compliance/job/compliance-hub-compliance-engine",
+				logger:      *logger,
+			},
+			want:    "compliance-hub-compliance-engine",
+			want1:   []string{},
+			wantErr: false,
+		},
+		{
+			name: "PipeLine_URL_folder_view",
+			args: args{
+				baseURL:     "https://gauntlet-3.cloudbees.com",
+				pipeLineURL: "https://gauntlet-3.cloudbees.com/job/BuildJobs/view/Release/job/compliance-hub-compliance-engine/",
+				logger:      *logger,
+			},
+			want:    "compliance-hub-compliance-engine",
+			want1:   []string{"BuildJobs"},
+			wantErr: false,
+		},
 		{
 			name: "PipeLine_URL_Normal_2",
 			args: args{
@@ -114,3 +154,277 @@ func Test_extractJobDetails1(t *testing.T) {
 		})
 	}
 }
+
+func TestGetJobClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		class string
+		want  string
+	}{
+		{
+			name:  "Folder",
+			class: "com.cloudbees.hudson.plugins.folder.Folder",
+			want:  JobClassFolder,
+		},
+		{
+			name:  "Pipeline",
+			class: "org.jenkinsci.plugins.workflow.job.WorkflowJob",
+			want:  JobClassPipeline,
+		},
+		{
+			name:  "MultiBranch",
+			class: "org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject",
+			want:  JobClassMultiBranch,
+		},
+		{
+			name:  "Organization",
+			class: "jenkins.branch.OrganizationFolder",
+			want:  JobClassOrganization,
+		},
+		{
+			name:  "Freestyle",
+			class: "hudson.model.FreeStyleProject",
+			want:  JobClassOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetJobClass(tt.class); got != tt.want {
+				t.Errorf("GetJobClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_branchKind(t *testing.T) {
+	kinds := map[string]string{"PR-1": BranchKindChangeRequest, "v1.0": BranchKindTag}
+	tests := []struct {
+		name string
+		job  string
+		want string
+	}{
+		{name: "ChangeRequest", job: "PR-1", want: BranchKindChangeRequest},
+		{name: "Tag", job: "v1.0", want: BranchKindTag},
+		{name: "Branch", job: "main", want: BranchKindBranch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := branchKind(kinds, tt.job); got != tt.want {
+				t.Errorf("branchKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_makeAccountMetadata(t *testing.T) {
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	pipelines := []*pipelineJob{
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: &gojenkins.JobResponse{Class: "org.jenkinsci.plugins.workflow.job.WorkflowJob"}, Base: "/job/team-a/job/deploy"}},
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: &gojenkins.JobResponse{Class: "org.jenkinsci.plugins.workflow.job.WorkflowJob"}, Base: "/job/team-a/job/app/job/main"}, multiBranch: "team-a/app"},
+		{Job: &gojenkins.Job{Jenkins: jenkins, Raw: &gojenkins.JobResponse{Class: "org.jenkinsci.plugins.workflow.job.WorkflowJob"}, Base: "/job/new"}},
+	}
+	discovered := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	saved, err := json.Marshal(&AccountConfig{
+		Version:     MetadataVersion,
+		Pipelines:   []string{"team-a/deploy"},
+		Views:       []string{"Production"},
+		Include:     []string{"team-a/**"},
+		Exclude:     []string{"**/sandbox-*"},
+		Nodes:       []string{"linux-*"},
+		Concurrency: 2,
+		Items:       []*ItemMetadata{{Path: "team-a/deploy", DiscoveredAt: discovered}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &jenkinsMasterService{}
+	metadata, err := cs.makeAccountMetadata(pipelines, CredTypePassword, saved)
+	if err != nil {
+		t.Fatalf("makeAccountMetadata() error = %v", err)
+	}
+	got, err := parseAccountConfig(metadata)
+	if err != nil {
+		t.Fatalf("parseAccountConfig() error = %v", err)
+	}
+	// the multibranch project is selected so that branches created later are picked up
+	if want := []string{"team-a/deploy", "team-a/app", "new"}; !reflect.DeepEqual(got.Pipelines, want) {
+		t.Errorf("makeAccountMetadata() pipelines = %v, want %v", got.Pipelines, want)
+	}
+	kept := AccountConfig{Views: got.Views, Include: got.Include, Exclude: got.Exclude, Nodes: got.Nodes, Concurrency: got.Concurrency}
+	want := AccountConfig{Views: []string{"Production"}, Include: []string{"team-a/**"}, Exclude: []string{"**/sandbox-*"}, Nodes: []string{"linux-*"}, Concurrency: 2}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("makeAccountMetadata() settings = %+v, want %+v", kept, want)
+	}
+	if got.CredentialType != CredTypePassword {
+		t.Errorf("makeAccountMetadata() credential type = %v, want %v", got.CredentialType, CredTypePassword)
+	}
+	var paths []string
+	for _, item := range got.Items {
+		paths = append(paths, item.Path)
+	}
+	if want := []string{"team-a/deploy", "team-a/app/main", "new"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("makeAccountMetadata() items = %v, want %v", paths, want)
+	}
+	if len(got.Items) != 3 || !got.Items[0].DiscoveredAt.Equal(discovered) || got.Items[1].DiscoveredAt.Equal(discovered) {
+		t.Errorf("makeAccountMetadata() items = %+v, want team-a/deploy discovered at %v", got.Items, discovered)
+	}
+}
+
+func Test_executeController_unreadableFolder(t *testing.T) {
+	const folder = "com.cloudbees.hudson.plugins.folder.Folder"
+	const pipeline = "org.jenkinsci.plugins.workflow.job.WorkflowJob"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/json":
+			fmt.Fprintf(w, `{"jobs":[{"_class":%q,"name":"ok","url":"%[2]s/job/ok/","jobs":[{"_class":%q,"name":"p","url":"%[2]s/job/ok/job/p/"}]},`+
+				`{"_class":%[1]q,"name":"secret","url":"%[2]s/job/secret/"}]}`, folder, server.URL, pipeline)
+		case "/job/ok/api/json":
+			fmt.Fprintf(w, `{"_class":%q,"name":"ok","url":"%s/job/ok/","jobs":[{"name":"p","url":"%[2]s/job/ok/job/p/"}]}`, folder, server.URL)
+		case "/job/ok/job/p/api/json":
+			fmt.Fprintf(w, `{"_class":%q,"name":"p","url":"%s/job/ok/job/p/"}`, pipeline, server.URL)
+		case "/computer/api/json":
+			fmt.Fprint(w, `{"computer":[]}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+	viper.Set("execution.metadata.refresh", true)
+	defer viper.Set("execution.metadata.refresh", nil)
+
+	tests := []struct {
+		name         string
+		config       AccountConfig
+		wantFailure  bool
+		wantNotFound bool
+	}{
+		{
+			// reconciling would drop gone, but not with secret unread
+			name: "Selected",
+			config: AccountConfig{
+				Version:   MetadataVersion,
+				Pipelines: []string{"ok/p", "gone"},
+				Items:     []*ItemMetadata{{Path: "ok/p", Class: JobClassPipeline}, {Path: "gone", Class: JobClassPipeline}},
+			},
+			wantNotFound: true,
+		},
+		{
+			name:        "All",
+			config:      AccountConfig{Version: MetadataVersion, Include: []string{"**"}},
+			wantFailure: true,
+		},
+	}
+	for _, mode := range []string{DiscoveryModeTree, DiscoveryModeWalk} {
+		for _, tt := range tests {
+			t.Run(mode+"_"+tt.name, func(t *testing.T) {
+				viper.Set("discovery.mode", mode)
+				defer viper.Set("discovery.mode", nil)
+				metadata, err := encodeAccountConfig(&tt.config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stream := &fakeMasterStream{}
+				responses := newResponseStream(stream, nil, "test")
+
+				cs := &jenkinsMasterService{}
+				if err := cs.executeController(context.Background(), jenkins, &controllerInfo{}, metadata, nil, responses, true, "test"); err != nil {
+					t.Fatalf("executeController() error = %v", err)
+				}
+				if _, err := responses.finish(); err != nil {
+					t.Fatal(err)
+				}
+				sent := map[string]string{}
+				for _, response := range stream.responses {
+					sent[response.Asset.Identifier] = response.Asset.Attributes[AttrError]
+				}
+				if failure, ok := sent[server.URL+"/job/ok/job/p/"]; !ok || len(failure) > 0 {
+					t.Errorf("executeController() sent %v, want ok/p", sent)
+				}
+				if failure, ok := sent[server.URL+"/job/secret/"]; ok != tt.wantFailure || ok && failure != AssetErrorForbidden {
+					t.Errorf("executeController() sent %v, want secret failed %v", sent, tt.wantFailure)
+				}
+				if failure, ok := sent[server.URL+"/job/gone/"]; ok != tt.wantNotFound || ok && failure != AssetErrorNotFound {
+					t.Errorf("executeController() sent %v, want gone not found %v", sent, tt.wantNotFound)
+				}
+				if len(stream.metadata) > 0 {
+					t.Errorf("executeController() refreshed the account metadata to %s", stream.metadata[0])
+				}
+			})
+		}
+	}
+}
+
+func Test_getSelectedJobs_invalidAccountURL(t *testing.T) {
+	jenkins := gojenkins.CreateJenkins(nil, "ftp://jenkins")
+	responses := newResponseStream(nil, nil, "test")
+	ctx := withPipelineSink(context.Background(), responses)
+	cs := &jenkinsMasterService{}
+
+	jobs, err := cs.getSelectedJobs(ctx, jenkins, []string{"https://jenkins/job/a/", "https://jenkins/job/b/"}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("getSelectedJobs() error = %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("getSelectedJobs() = %v jobs, want none", len(jobs))
+	}
+	got, _ := responses.finish()
+	if len(got) != 2 {
+		t.Fatalf("getSelectedJobs() reported %v failures, want 2", len(got))
+	}
+	for i, identifier := range []string{"https://jenkins/job/a/", "https://jenkins/job/b/"} {
+		if got[i].Asset.Identifier != identifier || got[i].Asset.Attributes[AttrError] != AssetErrorOther {
+			t.Errorf("getSelectedJobs() reported %v %v, want %v failed", got[i].Asset.Identifier, got[i].Asset.Attributes, identifier)
+		}
+	}
+}
+
+func Test_executeController_identifiersWithoutRenames(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/job/new/api/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"_class":"org.jenkinsci.plugins.workflow.job.WorkflowJob","name":"new","url":"%s/job/new/",`+
+			`"firstBuild":{"number":1,"timestamp":100}}`, server.URL)
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+	viper.Set("execution.track.renames", true)
+	defer viper.Set("execution.track.renames", nil)
+
+	// new was recorded as old, which renames are only told from by a full discovery
+	metadata, err := json.Marshal(&AccountConfig{
+		Version:   MetadataVersion,
+		Pipelines: []string{"old"},
+		Items:     []*ItemMetadata{{Path: "old", URL: server.URL + "/job/old/", Class: JobClassPipeline, Fingerprint: "1@100"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &fakeMasterStream{}
+	urls := &rootURLMapping{accountURL: server.URL, rootURL: server.URL}
+	responses := newResponseStream(stream, urls, "test")
+	identifiers := []string{server.URL + "/job/old/", server.URL + "/job/new/"}
+
+	cs := &jenkinsMasterService{}
+	if err := cs.executeController(context.Background(), jenkins, &controllerInfo{}, metadata, identifiers, responses, true, "test"); err != nil {
+		t.Fatalf("executeController() error = %v", err)
+	}
+	if _, err := responses.finish(); err != nil {
+		t.Fatal(err)
+	}
+	sent := map[string]map[string]string{}
+	for _, response := range stream.responses {
+		sent[response.Asset.Identifier] = response.Asset.Attributes
+	}
+	if attributes := sent[server.URL+"/job/old/"]; attributes[AttrError] != AssetErrorNotFound {
+		t.Errorf("executeController() sent old with %v, want not found", attributes)
+	}
+	if attributes, ok := sent[server.URL+"/job/new/"]; !ok || len(attributes[AttrPreviousIdentifier]) > 0 {
+		t.Errorf("executeController() sent new with %v, want it without previous identifier", attributes)
+	}
+}
@@ -0,0 +1,267 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudbees-compliance/chlog-go/log"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+	service "github.com/cloudbees-compliance/chplugin-go/v0.4.0/servicev0_4_0"
+	"github.com/spf13/viper"
+)
+
+// pipelineSink receives the pipelines of a discovery root as soon as the root is fully discovered,
+// and the selected assets that could not be discovered
+type pipelineSink interface {
+	send(ctx context.Context, pipelines []*pipelineJob) error
+	fail(identifier string, err error) error
+}
+
+// withPipelineSink makes discoveries using ctx hand their pipelines to sink instead of returning them
+func withPipelineSink(ctx context.Context, sink pipelineSink) context.Context {
+	return context.WithValue(ctx, "pipelineSink", sink)
+}
+
+// emit hands the pipelines of a discovery root to the sink of ctx and returns the pipelines left to the
+// caller, that is none when there is a sink. Pipelines found before an error are handed over as well.
+func emit(ctx context.Context, pipelines []*pipelineJob, err error) ([]*pipelineJob, error) {
+	sink, ok := ctx.Value("pipelineSink").(pipelineSink)
+	if !ok {
+		return pipelines, err
+	}
+	if sinkErr := sink.send(ctx, pipelines); sinkErr != nil && err == nil {
+		err = sinkErr
+	}
+	return nil, err
+}
+
+// reportFailure hands a selected asset that could not be discovered to the sink of ctx, if any
+func reportFailure(ctx context.Context, identifier string, err error) error {
+	sink, ok := ctx.Value("pipelineSink").(pipelineSink)
+	if !ok {
+		return nil
+	}
+	return sink.fail(identifier, err)
+}
+
+// masterStream is the part of the master server stream used to send assets
+type masterStream interface {
+	Send(*service.ExecuteMasterResponse) error
+}
+
+// responseStream turns discovered pipelines into master responses and sends them on the stream in
+// batches. Without a stream the responses are kept until the execution completes.
+type responseStream struct {
+	mu        sync.Mutex
+	stream    masterStream
+	batchSize int
+	requestId string
+	urls      *rootURLMapping
+	// accept drops the pipelines filtered out by the account configuration when set
+	accept func(name string) bool
+	// parent sends the responses of the stream of a single controller, see forController
+	parent *responseStream
+	// controller is the identifier of the controller the assets live on
+	controller string
+	// flavor is the product flavor of the controller, see detectFlavor
+	flavor string
+	batch  []*domain.MasterResponse
+	// emitted tells whether the asset with an identifier was reported, and whether as a failure
+	emitted map[string]emission
+	sent    int
+}
+
+func newResponseStream(stream masterStream, urls *rootURLMapping, requestId string) *responseStream {
+	batchSize := viper.GetInt("execution.batch.size")
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &responseStream{
+		stream:    stream,
+		batchSize: batchSize,
+		requestId: requestId,
+		urls:      urls,
+		emitted:   map[string]emission{},
+	}
+}
+
+// send hands discovered pipelines to the stream, it is safe for concurrent use
+func (s *responseStream) send(ctx context.Context, pipelines []*pipelineJob) error {
+	if viper.GetBool("execution.attributes.builds") {
+		for _, pipeline := range pipelines {
+			if !s.accepts(pipeline) {
+				continue
+			}
+			// walking folders polls jobs without their last build
+			if err := fetchBuilds(ctx, pipeline); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Debug(s.requestId).Err(err).Msgf("Unable to get the builds of %s", pipeline.Base)
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pipeline := range pipelines {
+		if !s.accepts(pipeline) {
+			continue
+		}
+		if s.urls != nil {
+			pipeline.Raw.URL = s.urls.toAccountURL(pipeline.Raw.URL)
+		}
+		if err := s.add(toMasterResponse(pipeline, s.flavor)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accepts reports whether a pipeline is to be sent. A renamed or moved pipeline still is when it was
+// selected under its previous name, as the selection only follows it once the account metadata is refreshed.
+func (s *responseStream) accepts(pipeline *pipelineJob) bool {
+	if s.accept == nil || s.accept(jobFullName(pipeline.Job)) {
+		return true
+	}
+	return len(pipeline.previousName) > 0 && s.accept(pipeline.previousName)
+}
+
+// fail reports a selected asset that could not be discovered, unless it was discovered another way
+func (s *responseStream) fail(identifier string, err error) error {
+	return s.failAsset(AssetTypePipeline, s.flavor, identifier, err)
+}
+
+// failAsset reports a selected asset of the given type and subtype that could not be discovered
+func (s *responseStream) failAsset(assetType string, subType string, identifier string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := toFailureResponse(assetType, subType, identifier, err)
+	log.Warn(s.requestId).Err(err).Msgf("Reporting asset %s as %s", identifier, response.Asset.Attributes[AttrError])
+	return s.add(response)
+}
+
+// forController returns a stream for the assets of a single controller of the given flavor, which are
+// tagged with the controller and sent on s. The returned stream filters and maps pipelines on its own.
+func (s *responseStream) forController(urls *rootURLMapping, accountURL string, flavor string) *responseStream {
+	controller, err := controllerIdentifier(accountURL)
+	if err != nil {
+		log.Warn(s.requestId).Err(err).Msgf("Not tagging the assets of invalid controller URL %s", accountURL)
+	}
+	return &responseStream{
+		requestId:  s.requestId,
+		urls:       urls,
+		parent:     s,
+		controller: controller,
+		flavor:     flavor,
+	}
+}
+
+func (s *responseStream) add(response *domain.MasterResponse) error {
+	if len(s.controller) > 0 {
+		if response.Asset.Attributes == nil {
+			response.Asset.Attributes = map[string]string{}
+		}
+		if _, ok := response.Asset.Attributes[AttrController]; !ok {
+			response.Asset.Attributes[AttrController] = s.controller
+		}
+	}
+	if s.parent != nil {
+		s.parent.mu.Lock()
+		defer s.parent.mu.Unlock()
+		return s.parent.add(response)
+	}
+	// an asset requested through several identifiers or selections is reported once, unless it
+	// failed through one of them and was discovered through another
+	failed := len(response.Asset.Attributes[AttrError]) > 0
+	previous, ok := s.emitted[response.Asset.Identifier]
+	if ok && (failed || previous != emittedFailure) {
+		return nil
+	}
+	s.emitted[response.Asset.Identifier] = emittedAsset
+	if failed {
+		s.emitted[response.Asset.Identifier] = emittedFailure
+	}
+	if ok && s.replace(response) {
+		return nil
+	}
+	s.batch = append(s.batch, response)
+	if s.stream != nil && len(s.batch) >= s.batchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// emission is how an asset was reported on a stream
+type emission int
+
+const (
+	emittedAsset emission = iota + 1
+	emittedFailure
+)
+
+// replace swaps the pending response for the asset of response with it, and returns false when that response
+// was sent already
+func (s *responseStream) replace(response *domain.MasterResponse) bool {
+	for i, pending := range s.batch {
+		if pending.Asset.Identifier == response.Asset.Identifier {
+			s.batch[i] = response
+			return true
+		}
+	}
+	return false
+}
+
+func (s *responseStream) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	if err := s.stream.Send(&service.ExecuteMasterResponse{MasterResponses: s.batch}); err != nil {
+		log.Error(s.requestId).Err(err).Msgf("Unable to send %v assets on the master stream", len(s.batch))
+		return err
+	}
+	s.sent += len(s.batch)
+	log.Debug(s.requestId).Msgf("Sent %v assets on the master stream, %v in total", len(s.batch), s.sent)
+	s.batch = nil
+	return nil
+}
+
+// finish sends the last batch and returns the responses that still have to be returned to the hub,
+// which are none when they went out on the stream
+func (s *responseStream) finish() ([]*domain.MasterResponse, error) {
+	if s.parent != nil {
+		return s.parent.finish()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream == nil {
+		return s.batch, nil
+	}
+	return nil, s.flush()
+}
+
+// sendMetadata sends refreshed account metadata for the hub to persist, after the pending assets
+func (s *responseStream) sendMetadata(metadata []byte) error {
+	if s.parent != nil {
+		return s.parent.sendMetadata(metadata)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream == nil {
+		log.Warn(s.requestId).Msg("No master stream to return the refreshed account metadata on")
+		return nil
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.stream.Send(&service.ExecuteMasterResponse{AccountMetadata: metadata})
+}
+
+// count returns the number of assets sent or waiting to be sent
+func (s *responseStream) count() int {
+	if s.parent != nil {
+		return s.parent.count()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent + len(s.batch)
+}
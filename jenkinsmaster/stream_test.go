@@ -0,0 +1,229 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/bndr/gojenkins"
+	domain "github.com/cloudbees-compliance/chplugin-go/v0.4.0/domainv0_4_0"
+	service "github.com/cloudbees-compliance/chplugin-go/v0.4.0/servicev0_4_0"
+	"github.com/spf13/viper"
+)
+
+type fakeMasterStream struct {
+	batches   [][]string
+	responses []*domain.MasterResponse
+	metadata  [][]byte
+	err       error
+}
+
+func (s *fakeMasterStream) Send(rsp *service.ExecuteMasterResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	if rsp.AccountMetadata != nil {
+		s.metadata = append(s.metadata, rsp.AccountMetadata)
+		return nil
+	}
+	var batch []string
+	s.responses = append(s.responses, rsp.MasterResponses...)
+	for _, response := range rsp.MasterResponses {
+		batch = append(batch, response.Asset.Identifier)
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func Test_responseStream(t *testing.T) {
+	viper.Set("execution.batch.size", 2)
+	defer viper.Set("execution.batch.size", nil)
+
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	pipeline := func(base string) *pipelineJob {
+		return &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: base}}
+	}
+	discovered := [][]*pipelineJob{
+		{pipeline("/job/a"), pipeline("/job/b"), pipeline("/job/a")},
+		{pipeline("/job/skip"), pipeline("/job/c")},
+	}
+
+	tests := []struct {
+		name        string
+		stream      *fakeMasterStream
+		wantBatches [][]string
+		wantReturn  int
+		wantErr     bool
+	}{
+		{
+			name:   "Batches",
+			stream: &fakeMasterStream{},
+			wantBatches: [][]string{
+				{"https://jenkins/job/a/", "https://jenkins/job/b/"},
+				{"https://jenkins/job/c/"},
+			},
+		},
+		{
+			name:       "No_Stream",
+			wantReturn: 3,
+		},
+		{
+			name:    "Send_Failure",
+			stream:  &fakeMasterStream{err: errors.New("stream closed")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stream masterStream
+			if tt.stream != nil {
+				stream = tt.stream
+			}
+			responses := newResponseStream(stream, nil, "test")
+			responses.accept = func(name string) bool { return name != "skip" }
+			ctx := withPipelineSink(context.Background(), responses)
+
+			var err error
+			for _, pipelines := range discovered {
+				var left []*pipelineJob
+				left, err = emit(ctx, pipelines, nil)
+				if len(left) > 0 {
+					t.Errorf("emit() left %v pipelines to the caller", len(left))
+				}
+				if err != nil {
+					break
+				}
+			}
+			returned, finishErr := responses.finish()
+			if err == nil {
+				err = finishErr
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(returned) != tt.wantReturn {
+				t.Errorf("finish() returned %v responses, want %v", len(returned), tt.wantReturn)
+			}
+			if tt.stream != nil && !reflect.DeepEqual(tt.stream.batches, tt.wantBatches) {
+				t.Errorf("sent batches %v, want %v", tt.stream.batches, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func Test_emit_withoutSink(t *testing.T) {
+	pipelines := []*pipelineJob{{}}
+	wantErr := errors.New("failed")
+	got, err := emit(context.Background(), pipelines, wantErr)
+	if !reflect.DeepEqual(got, pipelines) || err != wantErr {
+		t.Errorf("emit() = %v, %v, want the pipelines and error unchanged", got, err)
+	}
+}
+
+func Test_responseStream_forController(t *testing.T) {
+	stream := &fakeMasterStream{}
+	responses := newResponseStream(stream, nil, "test")
+	teamA := responses.forController(nil, "https://cbci.example.com/team-a/", FlavorCBCI)
+	teamB := responses.forController(nil, "https://CBCI.example.com/team-b", FlavorCBCI)
+	teamA.accept = func(name string) bool { return name != "skip" }
+
+	pipeline := func(server string, base string) *pipelineJob {
+		jenkins := gojenkins.CreateJenkins(nil, server)
+		return &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: base}}
+	}
+	sends := []struct {
+		stream    *responseStream
+		pipelines []*pipelineJob
+	}{
+		{teamA, []*pipelineJob{pipeline("https://cbci.example.com/team-a", "/job/app"), pipeline("https://cbci.example.com/team-a", "/job/skip")}},
+		// filtering is up to each controller
+		{teamB, []*pipelineJob{pipeline("https://cbci.example.com/team-b", "/job/skip")}},
+	}
+	for _, send := range sends {
+		if err := send.stream.send(context.Background(), send.pipelines); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+	if _, err := teamB.finish(); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+
+	want := map[string]string{
+		"https://cbci.example.com/team-a/job/app/":  "https://cbci.example.com/team-a/",
+		"https://cbci.example.com/team-b/job/skip/": "https://cbci.example.com/team-b/",
+	}
+	got := map[string]string{}
+	for _, response := range stream.responses {
+		got[response.Asset.Identifier] = response.Asset.Attributes[AttrController]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent assets tagged %v, want %v", got, want)
+	}
+	if count := teamA.count(); count != 2 {
+		t.Errorf("count() = %v, want 2", count)
+	}
+}
+
+func Test_responseStream_failureThenSuccess(t *testing.T) {
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	app := &pipelineJob{Job: &gojenkins.Job{Jenkins: jenkins, Raw: new(gojenkins.JobResponse), Base: "/job/app"}}
+	errForbidden := &statusError{URL: "https://jenkins/job/app/", StatusCode: http.StatusForbidden}
+
+	tests := []struct {
+		name      string
+		batchSize int
+		failFirst bool
+		want      []string
+	}{
+		{
+			name:      "Failure_Pending",
+			batchSize: 10,
+			failFirst: true,
+			want:      []string{""},
+		},
+		{
+			name:      "Failure_Sent",
+			batchSize: 1,
+			failFirst: true,
+			want:      []string{AssetErrorForbidden, ""},
+		},
+		{
+			name:      "Success_First",
+			batchSize: 1,
+			want:      []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("execution.batch.size", tt.batchSize)
+			defer viper.Set("execution.batch.size", nil)
+			stream := &fakeMasterStream{}
+			responses := newResponseStream(stream, nil, "test")
+
+			if tt.failFirst {
+				if err := responses.fail("https://jenkins/job/app/", errForbidden); err != nil {
+					t.Fatalf("fail() error = %v", err)
+				}
+			}
+			if err := responses.send(context.Background(), []*pipelineJob{app}); err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+			if err := responses.fail("https://jenkins/job/app/", errForbidden); err != nil {
+				t.Fatalf("fail() error = %v", err)
+			}
+			if _, err := responses.finish(); err != nil {
+				t.Fatalf("finish() error = %v", err)
+			}
+
+			var got []string
+			for _, response := range stream.responses {
+				got = append(got, response.Asset.Attributes[AttrError])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent errors %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package jenkinsmaster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var ErrInvalidTLSConfig = errors.New("invalid TLS configuration")
+
+// tlsConfig returns the TLS configuration of the credentials: the PEM encoded CA bundle trusted on top
+// of the system roots, the PEM encoded client certificate and key presented for mutual TLS and the
+// server name verified instead of the host of the URL. Credentials without any use the defaults.
+func tlsConfig(creds *jenkinsCreds) (*tls.Config, error) {
+	if len(creds.CACertificates) == 0 && len(creds.ClientCertificate) == 0 && len(creds.ClientKey) == 0 && len(creds.ServerName) == 0 {
+		return nil, nil
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: creds.ServerName,
+	}
+	if len(creds.CACertificates) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(creds.CACertificates)) {
+			return nil, fmt.Errorf("%w: caCertificates holds no PEM encoded certificate", ErrInvalidTLSConfig)
+		}
+		config.RootCAs = pool
+	}
+	if len(creds.ClientCertificate) > 0 || len(creds.ClientKey) > 0 {
+		if len(creds.ClientCertificate) == 0 || len(creds.ClientKey) == 0 {
+			return nil, fmt.Errorf("%w: clientCertificate and clientKey go together", ErrInvalidTLSConfig)
+		}
+		certificate, err := tls.X509KeyPair([]byte(creds.ClientCertificate), []byte(creds.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: client certificate: %v", ErrInvalidTLSConfig, err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// tokenTransport returns the transport the OAuth2 token endpoint is called with: the transport of the
+// credentials, minus the server name override meant for Jenkins
+func tokenTransport(transport http.RoundTripper) http.RoundTripper {
+	jenkinsTransport, ok := transport.(*http.Transport)
+	if !ok || jenkinsTransport.TLSClientConfig == nil || len(jenkinsTransport.TLSClientConfig.ServerName) == 0 {
+		return transport
+	}
+	cloned := jenkinsTransport.Clone()
+	cloned.TLSClientConfig.ServerName = ""
+	return cloned
+}
+
+// endpointTransport returns a transport of its own for another Jenkins than the one of the account URL: a
+// clone of the transport of the credentials, minus the server name override meant for the account URL
+func endpointTransport(transport http.RoundTripper) http.RoundTripper {
+	jenkinsTransport, ok := transport.(*http.Transport)
+	if !ok {
+		return transport
+	}
+	cloned := jenkinsTransport.Clone()
+	if cloned.TLSClientConfig != nil {
+		cloned.TLSClientConfig.ServerName = ""
+	}
+	return cloned
+}
+
+// certificateError classifies the TLS handshake failure err is caused by, if any, and describes it
+func certificateError(err error) (string, string, bool) {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return FailureTLSUnknownAuthority, "the server certificate is signed by an unknown authority, set caCertificates to the CA bundle of the controller", true
+	case errors.As(err, &invalid):
+		return FailureTLSInvalidCertificate, fmt.Sprintf("the server certificate is invalid: %v", invalid), true
+	case errors.As(err, &hostname):
+		return FailureTLSHostnameMismatch, fmt.Sprintf("the server certificate does not match the host name, set serverName to the name it was issued for: %v", hostname), true
+	case errors.As(err, &recordHeader):
+		return FailureTLSNotTLS, "the server does not speak TLS, check the scheme of the URL", true
+	case err != nil && strings.Contains(err.Error(), "remote error: tls:"):
+		// the server refused the handshake, typically as it requires a client certificate or refused ours
+		return FailureTLSHandshakeRefused, fmt.Sprintf("the server refused the TLS handshake, check clientCertificate and clientKey: %v", err), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,128 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// clientKeyPair returns a self-signed PEM encoded client certificate and its key
+func clientKeyPair(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "compliance-hub"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+}
+
+func Test_tlsConfig(t *testing.T) {
+	certificate, key := clientKeyPair(t)
+	tests := []struct {
+		name       string
+		creds      jenkinsCreds
+		wantConfig bool
+		wantErr    error
+	}{
+		{name: "None", creds: jenkinsCreds{}},
+		{name: "CA_Bundle", creds: jenkinsCreds{CACertificates: certificate}, wantConfig: true},
+		{name: "CA_Bundle_Not_PEM", creds: jenkinsCreds{CACertificates: "not a certificate"}, wantErr: ErrInvalidTLSConfig},
+		{name: "Client_Certificate", creds: jenkinsCreds{ClientCertificate: certificate, ClientKey: key}, wantConfig: true},
+		{name: "Client_Certificate_Without_Key", creds: jenkinsCreds{ClientCertificate: certificate}, wantErr: ErrInvalidTLSConfig},
+		{name: "Client_Key_Mismatch", creds: jenkinsCreds{ClientCertificate: certificate, ClientKey: "garbage"}, wantErr: ErrInvalidTLSConfig},
+		{name: "Server_Name", creds: jenkinsCreds{ServerName: "jenkins.internal"}, wantConfig: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tlsConfig(&tt.creds)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("tlsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantConfig {
+				t.Errorf("tlsConfig() = %v, want a config %v", got, tt.wantConfig)
+			}
+		})
+	}
+}
+
+func Test_newTransport_CABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	get := func(creds *jenkinsCreds) error {
+		transport, err := newTransport(creds)
+		if err != nil {
+			t.Fatalf("newTransport() error = %v", err)
+		}
+		client := http.Client{Transport: &loggingTransport{ctx: context.Background(), transport: transport}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	err := get(&jenkinsCreds{})
+	if failure, _, _ := certificateError(err); failure != FailureTLSUnknownAuthority {
+		t.Errorf("certificateError(%v) = %q, want an unknown authority", err, failure)
+	}
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	if err := get(&jenkinsCreds{CACertificates: ca}); err != nil {
+		t.Errorf("GET with the CA bundle error = %v", err)
+	}
+	// the test certificate is issued for example.com and 127.0.0.1
+	err = get(&jenkinsCreds{CACertificates: ca, ServerName: "jenkins.internal"})
+	if failure, _, _ := certificateError(err); failure != FailureTLSHostnameMismatch {
+		t.Errorf("certificateError(%v) = %q, want a host name mismatch", err, failure)
+	}
+	if err := get(&jenkinsCreds{CACertificates: ca, ServerName: "example.com"}); err != nil {
+		t.Errorf("GET with the server name error = %v", err)
+	}
+}
+
+func Test_endpointTransport(t *testing.T) {
+	certificate, _ := clientKeyPair(t)
+	transport, err := newTransport(&jenkinsCreds{CACertificates: certificate, ServerName: "jenkins.internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := endpointTransport(transport).(*http.Transport)
+	if !ok || got == transport {
+		t.Fatalf("endpointTransport() = %v, want a clone of the transport", got)
+	}
+	if got.TLSClientConfig.ServerName != "" || got.TLSClientConfig.RootCAs == nil {
+		t.Errorf("endpointTransport() server name = %q, CA bundle kept %v, want no server name with the CA bundle",
+			got.TLSClientConfig.ServerName, got.TLSClientConfig.RootCAs != nil)
+	}
+	if name := transport.(*http.Transport).TLSClientConfig.ServerName; name != "jenkins.internal" {
+		t.Errorf("endpointTransport() changed the server name of the account to %q", name)
+	}
+	if got := endpointTransport(nil); got != nil {
+		t.Errorf("endpointTransport(nil) = %v, want the default transport", got)
+	}
+}
@@ -0,0 +1,261 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+	"github.com/spf13/viper"
+)
+
+const treeItemFields = "_class,name,url,color,displayName,buildable,description," + firstBuildFields + "," + lastBuildFields
+
+// views are needed to tell branches of a multibranch project from change requests and tags
+const treeViewFields = "views[name,jobs[name]]"
+
+// treeItem is a node of the item hierarchy returned by a tree query.
+// Jobs is nil when the node lies deeper than the query reached.
+type treeItem struct {
+	Class string `json:"_class"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Color string `json:"color"`
+	// DisplayName, Buildable and Description are reported as attributes of pipelines
+	DisplayName string `json:"displayName"`
+	Buildable   bool   `json:"buildable"`
+	Description string `json:"description"`
+	// FirstBuild and LastBuild are only set for jobs that have been built
+	FirstBuild *buildRef   `json:"firstBuild"`
+	LastBuild  *buildRef   `json:"lastBuild"`
+	Views      []treeView  `json:"views"`
+	Jobs       []*treeItem `json:"jobs"`
+}
+
+type treeView struct {
+	Name string      `json:"name"`
+	Jobs []*treeItem `json:"jobs"`
+}
+
+// buildTreeQuery returns a tree parameter nesting jobs[...] depth levels deep.
+// Every level but the innermost also fetches the views of its items, e.g. depth 2
+// gives jobs[<fields>,views[name,jobs[name]],jobs[<fields>]]. Items below the
+// innermost level come back without jobs and are walked with further requests.
+func buildTreeQuery(depth int) string {
+	item := treeItemFields
+	for i := 1; i < depth; i++ {
+		item = treeItemFields + "," + treeViewFields + ",jobs[" + item + "]"
+	}
+	return "jobs[" + item + "]"
+}
+
+// fetchItemTree returns the item hierarchy of the controller with a single request
+func fetchItemTree(ctx context.Context, jenkins *gojenkins.Jenkins) (*treeItem, error) {
+	root := new(treeItem)
+	query := map[string]string{
+		"tree": buildTreeQuery(viper.GetInt("discovery.tree.depth")),
+	}
+	if err := getJSON(ctx, jenkins, "/", root, query); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// treeWalker turns a fetched item tree into pipelines, walking folders the
+// tree query did not reach one request at a time
+type treeWalker struct {
+	cs      *jenkinsMasterService
+	jenkins *gojenkins.Jenkins
+	owners  map[string]string
+}
+
+func newTreeWalker(cs *jenkinsMasterService, jenkins *gojenkins.Jenkins) *treeWalker {
+	return &treeWalker{
+		cs:      cs,
+		jenkins: jenkins,
+		owners:  map[string]string{},
+	}
+}
+
+// selectPipelines returns the pipelines in or beneath the items selected by full name.
+// Items that cannot be found or discovered are reported as failed assets.
+func (w *treeWalker) selectPipelines(ctx context.Context, root *treeItem, names []string, requestId string) ([]*pipelineJob, error) {
+	var pipelines []*pipelineJob
+	for _, name := range names {
+		log.Debug(requestId).Msgf("Selected Job: %v", name)
+		path := strings.Split(name, "/")
+		item, parents, found, err := w.find(ctx, root, path)
+		if err == nil && !found {
+			err = &statusError{URL: w.jenkins.Server + itemBase(path...), StatusCode: http.StatusNotFound}
+		}
+		if err == nil {
+			var selected []*pipelineJob
+			selected, err = w.pipelines(ctx, []*treeItem{item}, parents)
+			selected, err = emit(ctx, selected, err)
+			pipelines = append(pipelines, selected...)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return pipelines, err
+			}
+			// the other selected items are still discovered
+			log.Error(requestId).Err(err).Msgf("Unable to discover pipelines of %s", name)
+			if err := reportFailure(ctx, nameIdentifier(w.jenkins, name), err); err != nil {
+				return pipelines, err
+			}
+		}
+	}
+	return pipelines, nil
+}
+
+// find looks up an item by its path, fetching the children of truncated folders on the way
+func (w *treeWalker) find(ctx context.Context, root *treeItem, path []string) (*treeItem, []*treeItem, bool, error) {
+	var parents []*treeItem
+	item := root
+	for i, name := range path {
+		if item.Jobs == nil && item != root {
+			if err := w.fetchChildren(ctx, item, parents); err != nil {
+				return nil, nil, false, err
+			}
+		}
+		var next *treeItem
+		for _, child := range item.Jobs {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, nil, false, nil
+		}
+		if i > 0 {
+			parents = append(parents, item)
+		}
+		item = next
+	}
+	return item, parents, true, nil
+}
+
+// fetchChildren completes a truncated item with another tree query rooted at it
+func (w *treeWalker) fetchChildren(ctx context.Context, item *treeItem, parents []*treeItem) error {
+	query := map[string]string{
+		"tree": treeViewFields + "," + buildTreeQuery(viper.GetInt("discovery.tree.depth")),
+	}
+	return getJSON(ctx, w.jenkins, treeItemBase(parents, item), item, query)
+}
+
+// rootPipelines returns the pipelines among and beneath the top level items, emitting them item by item.
+// Items failing to be discovered are handed to skip when set, along with why, instead of failing.
+func (w *treeWalker) rootPipelines(ctx context.Context, items []*treeItem, skip func(name string, err error)) ([]*pipelineJob, error) {
+	var pipelines []*pipelineJob
+	for _, item := range items {
+		found, err := w.pipelines(ctx, []*treeItem{item}, nil)
+		if err != nil && skip != nil && ctx.Err() == nil {
+			skip(item.Name, err)
+			err = nil
+		}
+		found, err = emit(ctx, found, err)
+		pipelines = append(pipelines, found...)
+		if err != nil {
+			return pipelines, err
+		}
+	}
+	return pipelines, nil
+}
+
+// pipelines returns the pipelines among and beneath items, whose parents are given outermost first
+func (w *treeWalker) pipelines(ctx context.Context, items []*treeItem, parents []*treeItem) ([]*pipelineJob, error) {
+	var pipelines []*pipelineJob
+	for _, item := range items {
+		switch GetJobClass(item.Class) {
+		case JobClassFolder, JobClassOrganization, JobClassMultiBranch:
+			if item.Jobs == nil {
+				// deeper than the tree query reached, fall back to walking it folder by folder
+				job, err := fetchJob(ctx, w.jenkins, treeItemBase(parents, item))
+				if err != nil {
+					return pipelines, err
+				}
+				nested, err := w.cs.expandJobs(ctx, []*gojenkins.Job{job})
+				pipelines = append(pipelines, nested...)
+				if err != nil {
+					return pipelines, err
+				}
+				continue
+			}
+			nested, err := w.pipelines(ctx, item.Jobs, append(parents[:len(parents):len(parents)], item))
+			pipelines = append(pipelines, nested...)
+			if err != nil {
+				return pipelines, err
+			}
+		case JobClassPipeline:
+			pipeline, err := w.toPipelineJob(ctx, parents, item)
+			if err != nil {
+				return pipelines, err
+			}
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+	return pipelines, nil
+}
+
+func (w *treeWalker) toPipelineJob(ctx context.Context, parents []*treeItem, item *treeItem) (*pipelineJob, error) {
+	pipeline := &pipelineJob{Job: w.toJob(parents, item)}
+	pipeline.setBuilds(item.FirstBuild, item.LastBuild)
+	if len(parents) == 0 {
+		return pipeline, nil
+	}
+	mb := parents[len(parents)-1]
+	if GetJobClass(mb.Class) != JobClassMultiBranch {
+		return pipeline, nil
+	}
+
+	kinds := map[string]string{}
+	for _, view := range mb.Views {
+		if kind, ok := branchKindViews[view.Name]; ok {
+			for _, job := range view.Jobs {
+				kinds[job.Name] = kind
+			}
+		}
+	}
+	pipeline.multiBranch = jobFullName(w.toJob(parents[:len(parents)-1], mb))
+	pipeline.branchKind = branchKind(kinds, item.Name)
+
+	if len(parents) < 2 || GetJobClass(parents[len(parents)-2].Class) != JobClassOrganization {
+		return pipeline, nil
+	}
+	org := w.toJob(parents[:len(parents)-2], parents[len(parents)-2])
+	orgName := jobFullName(org)
+	owner, ok := w.owners[orgName]
+	if !ok {
+		owner = getSCMOwner(ctx, org)
+		w.owners[orgName] = owner
+	}
+	assignOrganization([]*pipelineJob{pipeline}, org, owner, mb.Name)
+	return pipeline, nil
+}
+
+// toJob wraps a tree item in a job without polling it
+func (w *treeWalker) toJob(parents []*treeItem, item *treeItem) *gojenkins.Job {
+	return &gojenkins.Job{
+		Jenkins: w.jenkins,
+		Raw: &gojenkins.JobResponse{
+			Class:       item.Class,
+			Name:        item.Name,
+			URL:         item.URL,
+			Color:       item.Color,
+			DisplayName: item.DisplayName,
+			Buildable:   item.Buildable,
+			Description: item.Description,
+		},
+		Base: treeItemBase(parents, item),
+	}
+}
+
+func treeItemBase(parents []*treeItem, item *treeItem) string {
+	var path []string
+	for _, parent := range parents {
+		path = append(path, parent.Name)
+	}
+	return itemBase(append(path, item.Name)...)
+}
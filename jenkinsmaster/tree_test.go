@@ -0,0 +1,161 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_buildTreeQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		want  string
+	}{
+		{
+			name:  "Depth_0",
+			depth: 0,
+			want:  "jobs[_class,name,url,color,displayName,buildable,description,firstBuild[number,timestamp],lastBuild[number,timestamp]]",
+		},
+		{
+			name:  "Depth_1",
+			depth: 1,
+			want:  "jobs[_class,name,url,color,displayName,buildable,description,firstBuild[number,timestamp],lastBuild[number,timestamp]]",
+		},
+		{
+			name:  "Depth_2",
+			depth: 2,
+			want: "jobs[_class,name,url,color,displayName,buildable,description,firstBuild[number,timestamp],lastBuild[number,timestamp]," +
+				"views[name,jobs[name]],jobs[_class,name,url,color,displayName,buildable,description,firstBuild[number,timestamp],lastBuild[number,timestamp]]]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildTreeQuery(tt.depth); got != tt.want {
+				t.Errorf("buildTreeQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const testItemTree = `{
+  "jobs": [
+    {"_class": "org.jenkinsci.plugins.workflow.job.WorkflowJob", "name": "standalone", "url": "https://jenkins/job/standalone/"},
+    {"_class": "hudson.model.FreeStyleProject", "name": "freestyle", "url": "https://jenkins/job/freestyle/"},
+    {"_class": "com.cloudbees.hudson.plugins.folder.Folder", "name": "team-a", "url": "https://jenkins/job/team-a/", "jobs": [
+      {"_class": "org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject", "name": "app", "url": "https://jenkins/job/team-a/job/app/",
+        "views": [{"name": "change-requests", "jobs": [{"name": "PR-7"}]}, {"name": "default", "jobs": [{"name": "main"}]}],
+        "jobs": [
+          {"_class": "org.jenkinsci.plugins.workflow.job.WorkflowJob", "name": "main", "url": "https://jenkins/job/team-a/job/app/job/main/"},
+          {"_class": "org.jenkinsci.plugins.workflow.job.WorkflowJob", "name": "PR-7", "url": "https://jenkins/job/team-a/job/app/job/PR-7/"}
+        ]
+      },
+      {"_class": "com.cloudbees.hudson.plugins.folder.Folder", "name": "empty", "url": "https://jenkins/job/team-a/job/empty/", "jobs": []}
+    ]}
+  ]
+}`
+
+func Test_treeWalker_pipelines(t *testing.T) {
+	root := new(treeItem)
+	if err := json.Unmarshal([]byte(testItemTree), root); err != nil {
+		t.Fatal(err)
+	}
+	w := newTreeWalker(&jenkinsMasterService{}, gojenkins.CreateJenkins(nil, "https://jenkins"))
+
+	pipelines, err := w.pipelines(context.Background(), root.Jobs, nil)
+	if err != nil {
+		t.Fatalf("pipelines() error = %v", err)
+	}
+
+	want := []struct {
+		fullName    string
+		multiBranch string
+		branchKind  string
+	}{
+		{fullName: "standalone"},
+		{fullName: "team-a/app/main", multiBranch: "team-a/app", branchKind: BranchKindBranch},
+		{fullName: "team-a/app/PR-7", multiBranch: "team-a/app", branchKind: BranchKindChangeRequest},
+	}
+	if len(pipelines) != len(want) {
+		t.Fatalf("pipelines() got %v pipelines, want %v", len(pipelines), len(want))
+	}
+	for i, w := range want {
+		got := pipelines[i]
+		if jobFullName(got.Job) != w.fullName || got.multiBranch != w.multiBranch || got.branchKind != w.branchKind {
+			t.Errorf("pipelines()[%v] = %v %v %v, want %v", i, jobFullName(got.Job), got.multiBranch, got.branchKind, w)
+		}
+	}
+}
+
+func Test_treeWalker_selectPipelines_missing(t *testing.T) {
+	root := new(treeItem)
+	if err := json.Unmarshal([]byte(testItemTree), root); err != nil {
+		t.Fatal(err)
+	}
+	jenkins := gojenkins.CreateJenkins(nil, "https://jenkins")
+	w := newTreeWalker(&jenkinsMasterService{}, jenkins)
+	responses := newResponseStream(nil, nil, "test")
+	ctx := withPipelineSink(context.Background(), responses)
+
+	_, err := w.selectPipelines(ctx, root, []string{"team-a/gone", "standalone"}, "test")
+	if err != nil {
+		t.Fatalf("selectPipelines() error = %v", err)
+	}
+	got, _ := responses.finish()
+	if len(got) != 2 {
+		t.Fatalf("selectPipelines() sent %v responses, want 2", len(got))
+	}
+	if got[0].Asset.Identifier != "https://jenkins/job/team-a/job/gone/" || got[0].Asset.Attributes[AttrError] != AssetErrorNotFound {
+		t.Errorf("selectPipelines() reported %v %v, want team-a/gone not found", got[0].Asset.Identifier, got[0].Asset.Attributes)
+	}
+	if got[1].Asset.Identifier != "https://jenkins/job/standalone/" || len(got[1].Asset.Attributes[AttrError]) > 0 {
+		t.Errorf("selectPipelines() sent %v %v, want standalone", got[1].Asset.Identifier, got[1].Asset.Attributes)
+	}
+}
+
+func Test_treeWalker_selectPipelines_forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/json" {
+			fmt.Fprint(w, `{"jobs":[{"_class":"com.cloudbees.hudson.plugins.folder.Folder","name":"secret"}]}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+	responses := newResponseStream(nil, nil, "test")
+	ctx := withPipelineSink(context.Background(), responses)
+
+	root, err := fetchItemTree(ctx, jenkins)
+	if err != nil {
+		t.Fatalf("fetchItemTree() error = %v", err)
+	}
+	// the folder lies deeper than the tree query reached
+	if _, err := newTreeWalker(&jenkinsMasterService{}, jenkins).selectPipelines(ctx, root, []string{"secret/x"}, "test"); err != nil {
+		t.Fatalf("selectPipelines() error = %v", err)
+	}
+	got, _ := responses.finish()
+	if len(got) != 1 || got[0].Asset.Attributes[AttrError] != AssetErrorForbidden {
+		t.Errorf("selectPipelines() sent %v, want secret/x forbidden", got)
+	}
+}
+
+func Test_fetchItemTree_status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+
+	_, err := fetchItemTree(context.Background(), jenkins)
+	var status *statusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("fetchItemTree() error = %v, want status %v", err, http.StatusServiceUnavailable)
+	}
+}
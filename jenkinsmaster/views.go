@@ -0,0 +1,100 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/bndr/gojenkins"
+	"github.com/cloudbees-compliance/chlog-go/log"
+)
+
+const AssetTypeView = "VIEW"
+
+// viewContents holds the items and, for nested views, the child views of a Jenkins view
+type viewContents struct {
+	Jobs []struct {
+		FullName string `json:"fullName"`
+	} `json:"jobs"`
+	Views []struct {
+		Name string `json:"name"`
+	} `json:"views"`
+}
+
+// getViewJobNames returns the full names of the items in the given views. A view is named by
+// its path, e.g. teams/team-a for the view team-a nested in the view teams, and the items of
+// every view nested in it are included. Views that are missing or unreadable are reported as
+// failed assets and skipped.
+func getViewJobNames(ctx context.Context, jenkins *gojenkins.Jenkins, views []string, responses *responseStream, requestId string) ([]string, error) {
+	var names []string
+	for _, view := range views {
+		viewNames, err := getNestedViewJobNames(ctx, jenkins, viewBase(view), requestId)
+		var status *statusError
+		if errors.As(err, &status) {
+			log.Error(requestId).Err(err).Msgf("Unable to read Jenkins view %s", view)
+			if err := responses.failView(jenkins, view, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Debug(requestId).Msgf("Selected view %s holds %v items", view, len(viewNames))
+		names = append(names, viewNames...)
+	}
+	return names, nil
+}
+
+func getNestedViewJobNames(ctx context.Context, jenkins *gojenkins.Jenkins, base string, requestId string) ([]string, error) {
+	contents := new(viewContents)
+	query := map[string]string{
+		"tree": "jobs[fullName],views[name]",
+	}
+	if err := getJSON(ctx, jenkins, base, contents, query); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, job := range contents.Jobs {
+		names = append(names, job.FullName)
+	}
+	for _, child := range contents.Views {
+		childNames, err := getNestedViewJobNames(ctx, jenkins, base+"/view/"+url.PathEscape(child.Name), requestId)
+		var status *statusError
+		if errors.As(err, &status) {
+			// the selected view itself was readable, a nested view gone meanwhile only holds fewer items
+			log.Debug(requestId).Err(err).Msgf("Skipping nested Jenkins view %s", child.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, childNames...)
+	}
+	return names, nil
+}
+
+// failView reports a selected view that is missing or unreadable
+func (s *responseStream) failView(jenkins *gojenkins.Jenkins, view string, err error) error {
+	return s.failAsset(AssetTypeView, "", viewIdentifier(jenkins, view), err)
+}
+
+// viewIdentifier returns the URL of a view, or its path when the account URL is unusable
+func viewIdentifier(jenkins *gojenkins.Jenkins, view string) string {
+	base, err := canonicalBaseURL(jenkins.Server)
+	if err != nil {
+		return view
+	}
+	return base + viewBase(view) + "/"
+}
+
+// viewBase returns the escaped URL path of a view, e.g. /view/teams/view/team-a for teams/team-a
+func viewBase(view string) string {
+	var base strings.Builder
+	for _, name := range strings.Split(strings.Trim(view, "/"), "/") {
+		base.WriteString("/view/" + url.PathEscape(name))
+	}
+	return base.String()
+}
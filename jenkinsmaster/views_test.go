@@ -0,0 +1,117 @@
+package jenkinsmaster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bndr/gojenkins"
+)
+
+func Test_viewBase(t *testing.T) {
+	tests := []struct {
+		name string
+		view string
+		want string
+	}{
+		{
+			name: "Top_Level",
+			view: "team-a",
+			want: "/view/team-a",
+		},
+		{
+			name: "Nested",
+			view: "teams/team-a",
+			want: "/view/teams/view/team-a",
+		},
+		{
+			name: "Surrounding_Slashes",
+			view: "/teams/team-a/",
+			want: "/view/teams/view/team-a",
+		},
+		{
+			name: "Escaped",
+			view: "my view/équipe",
+			want: "/view/my%20view/view/%C3%A9quipe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := viewBase(tt.view); got != tt.want {
+				t.Errorf("viewBase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getViewJobNames(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/view/teams/api/json":
+			fmt.Fprint(w, `{"jobs":[{"fullName":"shared"}],"views":[{"name":"team-a"},{"name":"gone"}]}`)
+		case "/view/teams/view/team-a/api/json":
+			fmt.Fprint(w, `{"jobs":[{"fullName":"team-a/app"}],"views":[]}`)
+		case "/view/secret/api/json":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	jenkins := gojenkins.CreateJenkins(server.Client(), server.URL)
+
+	tests := []struct {
+		name       string
+		views      []string
+		want       []string
+		wantFailed map[string]string
+	}{
+		{
+			name:  "Nested_Views",
+			views: []string{"teams"},
+			want:  []string{"shared", "team-a/app"},
+		},
+		{
+			name:  "Nested_View_Path",
+			views: []string{"teams/team-a"},
+			want:  []string{"team-a/app"},
+		},
+		{
+			name:       "Missing_View",
+			views:      []string{"missing", "teams/team-a"},
+			want:       []string{"team-a/app"},
+			wantFailed: map[string]string{server.URL + "/view/missing/": AssetErrorNotFound},
+		},
+		{
+			name:       "Forbidden_View",
+			views:      []string{"secret"},
+			wantFailed: map[string]string{server.URL + "/view/secret/": AssetErrorForbidden},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := newResponseStream(nil, nil, "test")
+			got, err := getViewJobNames(context.Background(), jenkins, tt.views, responses, "test")
+			if err != nil {
+				t.Fatalf("getViewJobNames() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getViewJobNames() = %v, want %v", got, tt.want)
+			}
+			sent, _ := responses.finish()
+			failed := map[string]string{}
+			for _, response := range sent {
+				if response.Asset.Type != AssetTypeView {
+					t.Errorf("getViewJobNames() reported a %v asset, want %v", response.Asset.Type, AssetTypeView)
+				}
+				failed[response.Asset.Identifier] = response.Asset.Attributes[AttrError]
+			}
+			if len(failed) != len(tt.wantFailed) || (len(failed) > 0 && !reflect.DeepEqual(failed, tt.wantFailed)) {
+				t.Errorf("getViewJobNames() reported %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}